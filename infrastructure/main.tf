@@ -72,5 +72,9 @@ module "api" {
   cars_db_password = var.db_password
   cars_db_name     = module.cars.db.name
 
+  drivers_db_user     = module.drivers.db_user.name
+  drivers_db_password = var.db_password
+  drivers_db_name     = module.drivers.db.name
+
   region = var.region
 }
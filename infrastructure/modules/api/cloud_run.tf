@@ -57,6 +57,22 @@ resource "google_cloud_run_v2_service" "api" {
         name  = "CARS_DB_HOST"
         value = "/cloudsql/${var.db_connection_name}"
       }
+      env {
+        name  = "DRIVERS_DB_USER"
+        value = var.drivers_db_user
+      }
+      env {
+        name  = "DRIVERS_DB_PASS"
+        value = var.drivers_db_password
+      }
+      env {
+        name  = "DRIVERS_DB_NAME"
+        value = var.drivers_db_name
+      }
+      env {
+        name  = "DRIVERS_DB_HOST"
+        value = "/cloudsql/${var.db_connection_name}"
+      }
     }
 
     volumes {
@@ -22,6 +22,16 @@ variable "cars_db_name" {
   type = string
 }
 
+variable "drivers_db_user" {
+  type = string
+}
+variable "drivers_db_password" {
+  type = string
+}
+variable "drivers_db_name" {
+  type = string
+}
+
 variable "region" {
   type    = string
   default = "europe-west1"
@@ -1,44 +1,9 @@
-variable "classes" {
-  type = map(object({
-    id   = string
-    cron = string
-  }))
-
-  default = {
-    sports_car = {
-      id   = "sports-car"
-      cron = "0 2 * * *"
-    }
-    oval = {
-      id   = "oval"
-      cron = "10 2 * * *"
-    }
-    formula_car = {
-      id   = "formula-car"
-      cron = "20 2 * * *"
-    }
-    road = {
-      id   = "road"
-      cron = "30 2 * * *"
-    }
-    dirt_oval = {
-      id   = "dirt-oval"
-      cron = "40 2 * * *"
-    }
-    dirt_road = {
-      id   = "dirt-road"
-      cron = "50 2 * * *"
-    }
-  }
-}
-
-module "drivers_jobs" {
+# A single job imports all the car classes, so that the drivers missing from all of them can be marked
+module "drivers_job" {
   source = "../cloudrun-job"
 
-  for_each = var.classes
-
-  name           = "drivers-downloader-job-${each.value.id}"
-  short_name     = "dd-job-${each.value.id}"
+  name           = "drivers-downloader-job"
+  short_name     = "dd-job"
   region         = var.region
   project        = var.project
   project_number = var.project_number
@@ -50,7 +15,7 @@ module "drivers_jobs" {
     DB_PASS          = google_sql_user.drivers_downloader.password
     DB_NAME          = google_sql_database.database.name
     DB_HOST          = "/cloudsql/${var.db_connection_name}"
-    CAR_CLASS        = each.key
+    CAR_CLASS        = "all"
   }
 
   image = "europe-west1-docker.pkg.dev/sharedtelemetryapp/sessions-downloader/drivers-downloader:latest"
@@ -58,16 +23,14 @@ module "drivers_jobs" {
   db_connection_name = var.db_connection_name
 }
 
-module "drivers_jobs_cron" {
+module "drivers_job_cron" {
   source = "../cron"
 
-  for_each = var.classes
-
-  name           = "drivers-downloader-job-${each.value.id}"
-  short_name     = "dd-job-${each.value.id}"
+  name           = "drivers-downloader-job"
+  short_name     = "dd-job"
   region         = var.region
   project        = var.project
   project_number = var.project_number
-  schedule       = each.value.cron
-  job_name       = module.drivers_jobs[each.key].job.name
+  schedule       = "0 2 * * *"
+  job_name       = module.drivers_job.job.name
 }
@@ -0,0 +1,7 @@
+output "db" {
+  value = google_sql_database.database
+}
+
+output "db_user" {
+  value = google_sql_user.drivers_downloader
+}
@@ -13,8 +13,12 @@ module "sessions_downloader_function" {
     DB_PASS : google_sql_user.default.password,
     DB_NAME : google_sql_database.default.name,
     DB_HOST : "/cloudsql/${var.db_connection_name}",
+    PUBSUB_PROJECT : "sharedtelemetryapp",
+    SESSIONS_TOPIC : "sessions-downloader-topic",
+    ADMIN_TOKEN : var.admin_token
   }
   db_connection_name = var.db_connection_name
+  pubsub_client      = true
 }
 
 module "season_parser_function" {
@@ -33,7 +37,9 @@ module "season_parser_function" {
     DB_NAME : google_sql_database.default.name,
     DB_HOST : "/cloudsql/${var.db_connection_name}",
     PUBSUB_PROJECT : "sharedtelemetryapp",
-    PUBSUB_TOPIC : module.sessions_downloader_function.pubsub_topic.name
+    SEASONS_TOPIC : "season-parser-topic",
+    SESSIONS_TOPIC : module.sessions_downloader_function.pubsub_topic.name,
+    ADMIN_TOKEN : var.admin_token
   }
   db_connection_name = var.db_connection_name
   pubsub_client      = true
@@ -56,7 +62,7 @@ module "leagues_parser_job" {
     DB_NAME : google_sql_database.default.name,
     DB_HOST : "/cloudsql/${var.db_connection_name}",
     PUBSUB_PROJECT : "sharedtelemetryapp",
-    PUBSUB_TOPIC : module.season_parser_function.pubsub_topic.name
+    SEASONS_TOPIC : module.season_parser_function.pubsub_topic.name
   }
 
   image = "europe-west1-docker.pkg.dev/sharedtelemetryapp/sessions-downloader/leagues-parser:latest"
@@ -69,7 +75,7 @@ module "leagues_parser_job_cron" {
 
   name           = "leagues-parser-job"
   short_name     = "lp-job"
-  schedule       = "0 * * * *"
+  schedule       = "*/5 * * * *" # The minimum sync interval of the seasons (minSyncInterval in the season parser)
   region         = var.region
   project        = var.project
   project_number = var.project_number
@@ -18,6 +18,12 @@ variable "iracing_password" {
   type = string
 }
 
+variable "admin_token" {
+  type      = string
+  default   = ""
+  sensitive = true
+}
+
 variable "region" {
   type    = string
   default = "europe-west1"
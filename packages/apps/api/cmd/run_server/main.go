@@ -29,6 +29,12 @@ func main() {
 	carsDbPort := os.Getenv("CARS_DB_PORT")
 	carsDbHost := os.Getenv("CARS_DB_HOST")
 
+	driversDbUser := os.Getenv("DRIVERS_DB_USER")
+	driversDbPass := os.Getenv("DRIVERS_DB_PASS")
+	driversDbName := os.Getenv("DRIVERS_DB_NAME")
+	driversDbPort := os.Getenv("DRIVERS_DB_PORT")
+	driversDbHost := os.Getenv("DRIVERS_DB_HOST")
+
 	// Initialize database
 	eventsDb, err := database.Connect(eventsDbUser, eventsDbPass, eventsDbHost, eventsDbPort, eventsDbName, 1, 1)
 	if err != nil {
@@ -40,16 +46,65 @@ func main() {
 		log.Fatal(err)
 	}
 
+	driversDb, err := database.Connect(driversDbUser, driversDbPass, driversDbHost, driversDbPort, driversDbName, 1, 1)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	r := gin.Default()
 
 	// Handlers
 	r.GET("/competitions/:id/ranking", func(c *gin.Context) {
-		handlers.CompetitionRankingHandler(c, eventsDb, carsDb)
+		handlers.CompetitionRankingHandler(c, eventsDb, carsDb, driversDb)
 	})
 
 	r.GET("/competitions/:id/csv", func(c *gin.Context) {
 		handlers.CompetitionCsvHandler(c, eventsDb)
 	})
 
+	r.GET("/competitions/:id/calendar", func(c *gin.Context) {
+		handlers.CompetitionCalendarHandler(c, eventsDb)
+	})
+
+	r.GET("/leagues/:id", func(c *gin.Context) {
+		handlers.LeagueHandler(c, eventsDb)
+	})
+
+	r.GET("/leagues/:id/seasons/:seasonId/status", func(c *gin.Context) {
+		handlers.SeasonStatusHandler(c, eventsDb)
+	})
+
+	r.GET("/sessions/:id/status", func(c *gin.Context) {
+		handlers.SessionStatusHandler(c, eventsDb)
+	})
+
+	r.GET("/drivers", func(c *gin.Context) {
+		handlers.DriversSearchHandler(c, driversDb)
+	})
+
+	r.POST("/drivers/lookup", func(c *gin.Context) {
+		handlers.DriversLookupHandler(c, driversDb)
+	})
+
+	r.GET("/drivers/changes", func(c *gin.Context) {
+		handlers.DriversChangesHandler(c, driversDb)
+	})
+
+	r.GET("/drivers/:id", func(c *gin.Context) {
+		handlers.DriverHandler(c, driversDb)
+	})
+
+	r.GET("/drivers/:id/names", func(c *gin.Context) {
+		handlers.DriverNameChangesHandler(c, driversDb)
+	})
+
+	r.GET("/drivers/:id/stats", func(c *gin.Context) {
+		handlers.DriverStatsHandler(c, driversDb)
+	})
+
+	r.GET("/drivers/:id/stats/history", func(c *gin.Context) {
+		handlers.DriverStatsHistoryHandler(c, driversDb)
+	})
+
 	r.Run()
 }
@@ -8,12 +8,14 @@ require (
 	github.com/lib/pq v1.10.9
 	gorm.io/gorm v1.25.12
 	riccardotornesello.it/sharedtelemetry/iracing/cars_models v0.0.0-00010101000000-000000000000
+	riccardotornesello.it/sharedtelemetry/iracing/drivers_models v0.0.0-00010101000000-000000000000
 	riccardotornesello.it/sharedtelemetry/iracing/events_models v0.0.0-00010101000000-000000000000
 	riccardotornesello.it/sharedtelemetry/iracing/gorm_utils v0.0.0-00010101000000-000000000000
 )
 
 replace (
 	riccardotornesello.it/sharedtelemetry/iracing/cars_models => ../../libs/cars_models
+	riccardotornesello.it/sharedtelemetry/iracing/drivers_models => ../../libs/drivers_models
 	riccardotornesello.it/sharedtelemetry/iracing/events_models => ../../libs/events_models
 	riccardotornesello.it/sharedtelemetry/iracing/gorm_utils => ../../libs/gorm_utils
 )
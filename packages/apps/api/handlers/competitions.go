@@ -3,27 +3,22 @@ package handlers
 import (
 	"errors"
 	"net/http"
-	"sort"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
 	"riccardotornesello.it/sharedtelemetry/iracing/api/logic"
+	"riccardotornesello.it/sharedtelemetry/iracing/api/ranking"
+	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
 )
 
 type RankingResponse struct {
 	Classes     []*ClassInfo        `json:"classes"`
-	Ranking     []*Rank             `json:"ranking"`
+	Ranking     []*ranking.Rank     `json:"ranking"`
 	Drivers     map[int]*DriverInfo `json:"drivers"`
 	EventGroups []*EventGroupInfo   `json:"eventGroups"`
 	Competition *CompetitionInfo    `json:"competition"`
-}
-
-type Rank struct {
-	Pos     int                     `json:"pos"`
-	CustId  int                     `json:"custId"`
-	Sum     int                     `json:"sum"`
-	IsValid bool                    `json:"isValid"`
-	Results map[uint]map[string]int `json:"results"`
+	Strength    *StrengthInfo       `json:"strength,omitempty"`
 }
 
 type TeamInfo struct {
@@ -54,6 +49,22 @@ type DriverInfo struct {
 	FirstName string   `json:"firstName"`
 	LastName  string   `json:"lastName"`
 	Crew      CrewInfo `json:"crew"`
+
+	// Only with the stats, if the driver has them
+	IRating      int      `json:"iRating,omitempty"`
+	License      string   `json:"license,omitempty"`
+	LicenseClass string   `json:"licenseClass,omitempty"`
+	SafetyRating *float64 `json:"safetyRating,omitempty"`
+	Location     string   `json:"location,omitempty"`
+}
+
+// Average iRating of the drivers with stats, overall and by team, crew and class
+type StrengthInfo struct {
+	CarCategory string       `json:"carCategory"`
+	AvgIRating  int          `json:"avgIRating"`
+	Teams       map[uint]int `json:"teams"`
+	Crews       map[uint]int `json:"crews"`
+	Classes     map[uint]int `json:"classes"`
 }
 
 type EventGroupInfo struct {
@@ -61,15 +72,64 @@ type EventGroupInfo struct {
 	Name    string   `json:"name"`
 	TrackId int      `json:"trackId"`
 	Dates   []string `json:"dates"`
+	Mode    string   `json:"mode"`
+	Laps    int      `json:"laps"`
+}
+
+type CalendarSessionInfo struct {
+	SessionId         int       `json:"sessionId"`
+	SubsessionId      int       `json:"subsessionId"`
+	LaunchAt          time.Time `json:"launchAt"`
+	TrackId           int       `json:"trackId"`
+	TrackName         string    `json:"trackName"`
+	TrackConfigName   string    `json:"trackConfigName"`
+	CarIds            []int64   `json:"carIds"`
+	PracticeLength    int       `json:"practiceLength"`
+	QualifyLength     int       `json:"qualifyLength"`
+	QualifyLaps       int       `json:"qualifyLaps"`
+	RaceLength        int       `json:"raceLength"`
+	RaceLaps          int       `json:"raceLaps"`
+	PasswordProtected bool      `json:"passwordProtected"`
+	HasResults        bool      `json:"hasResults"`
 }
 
 type CompetitionInfo struct {
-	Id               uint   `json:"id"`
-	Name             string `json:"name"`
-	CrewDriversCount int    `json:"crewDriversCount"`
+	Id               uint       `json:"id"`
+	Name             string     `json:"name"`
+	CrewDriversCount int        `json:"crewDriversCount"`
+	LeagueId         int        `json:"leagueId"`
+	SeasonId         int        `json:"seasonId"`
+	CarCategory      string     `json:"carCategory"`
+	Rules            *RulesInfo `json:"rules"`
 }
 
-func CompetitionRankingHandler(c *gin.Context, eventsDb *gorm.DB, carsDb *gorm.DB) {
+type RulesInfo struct {
+	Laps             int      `json:"laps"`
+	Mode             string   `json:"mode"`
+	DisallowedEvents []string `json:"disallowedEvents"`
+	AllowIncidents   bool     `json:"allowIncidents"`
+	RestartAfterPit  bool     `json:"restartAfterPit"`
+	SkipOutLap       bool     `json:"skipOutLap"`
+	Resolution       int      `json:"resolution"`
+	RoundTimes       bool     `json:"roundTimes"`
+}
+
+// newRulesInfo returns the rules and the resulting disallowed events.
+// The rules must be the ones validated by the ranking, with the defaults.
+func newRulesInfo(rules ranking.Rules) *RulesInfo {
+	return &RulesInfo{
+		Laps:             rules.StintLaps,
+		Mode:             rules.Mode,
+		DisallowedEvents: rules.InvalidatingEvents(),
+		AllowIncidents:   rules.AllowIncidents,
+		RestartAfterPit:  rules.RestartAfterPit,
+		SkipOutLap:       rules.SkipOutLap,
+		Resolution:       rules.Resolution,
+		RoundTimes:       rules.RoundTimes,
+	}
+}
+
+func CompetitionRankingHandler(c *gin.Context, eventsDb *gorm.DB, carsDb *gorm.DB, driversDb *gorm.DB) {
 	// Get the competition
 	competition, err := logic.GetCompetitionBySlug(eventsDb, c.Param("id"))
 	if err != nil {
@@ -82,46 +142,25 @@ func CompetitionRankingHandler(c *gin.Context, eventsDb *gorm.DB, carsDb *gorm.D
 		}
 	}
 
-	// Get the sessions valid for the competition
-	sessions, sessionsMap, err := logic.GetCompetitionSessions(eventsDb, competition.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting competition sessions"})
-		return
-	}
-
-	// Get event groups
-	eventGroups, err := logic.GetEventGroups(eventsDb, competition.ID)
+	// Compute the ranking
+	competitionRanking, err := computeCompetitionRanking(eventsDb, competition)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting event groups"})
-		return
-	}
+		if errors.Is(err, ranking.ErrUnknownPositions) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Missing finishing positions, the sessions must be downloaded again"})
+			return
+		}
 
-	// Get drivers
-	drivers, _, err := logic.GetCompetitionDrivers(eventsDb, competition.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting competition drivers"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error computing the ranking"})
 		return
 	}
+	drivers := competitionRanking.drivers
+	eventGroups := competitionRanking.eventGroups
 
-	driverCars := make(map[int]int)
 	allowedCars := make(map[int]bool)
 	for _, driver := range drivers {
-		driverCars[driver.IRacingCustId] = driver.Crew.IRacingCarId
 		allowedCars[driver.Crew.IRacingCarId] = true
 	}
 
-	// Get laps
-	var simsessionIds [][]int
-	for _, session := range sessions {
-		simsessionIds = append(simsessionIds, []int{session.SubsessionId, session.SimsessionNumber})
-	}
-
-	laps, err := logic.GetLaps(eventsDb, simsessionIds)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting laps"})
-		return
-	}
-
 	// Get cars
 	allwedCarIds := make([]int, 0)
 	for carId := range allowedCars {
@@ -147,155 +186,6 @@ func CompetitionRankingHandler(c *gin.Context, eventsDb *gorm.DB, carsDb *gorm.D
 		return
 	}
 
-	// Analyze
-	allResults := make(map[int]map[int]int)
-	bestResults := make(map[int]map[uint]map[string]int) // Customer ID, Group, Date, average ms
-
-	currentCustId := 0
-	currentSubsessionId := 0
-	stintEnd := false
-	stintValidLaps := 0
-	stintTimeSum := 0
-
-	for _, lap := range laps {
-		// Check the first key of driverResults
-		if lap.CustID != currentCustId {
-			allResults[lap.CustID] = make(map[int]int)
-			currentCustId = lap.CustID
-			stintEnd = false
-			stintValidLaps = 0
-			stintTimeSum = 0
-		}
-
-		if lap.SubsessionID != currentSubsessionId {
-			allResults[lap.CustID][lap.SubsessionID] = 0
-			currentSubsessionId = lap.SubsessionID
-			stintEnd = false
-			stintValidLaps = 0
-			stintTimeSum = 0
-		}
-
-		driverCar, ok := driverCars[lap.CustID]
-		if !ok {
-			continue
-		}
-
-		if driverCar != lap.SessionSimsessionParticipant.CarID {
-			continue
-		}
-
-		if stintEnd {
-			continue
-		}
-
-		if logic.IsLapPitted(lap.LapEvents) {
-			if stintValidLaps > 0 {
-				stintEnd = true
-			}
-
-			continue
-		}
-
-		if logic.IsLapValid(lap.LapNumber, lap.LapTime, lap.LapEvents, lap.Incident) {
-			stintValidLaps++
-			stintTimeSum += lap.LapTime
-
-			if stintValidLaps == 3 {
-				stintEnd = true
-
-				averageTime := stintTimeSum / 3 / 10
-
-				// Store the average time of the session for the driver (only valid stints)
-				allResults[lap.CustID][lap.SubsessionID] = averageTime
-
-				// Store the best result of the driver for the date in the event group (only valid stints)
-				sessionDetails := sessionsMap[lap.SubsessionID]
-				// 1. Add the customer to the map if it does not exist
-				if _, ok := bestResults[lap.CustID]; !ok {
-					bestResults[lap.CustID] = make(map[uint]map[string]int)
-				}
-				// 2. Add the event group to the map if it does not exist
-				if _, ok := bestResults[lap.CustID][sessionDetails.EventGroupId]; !ok {
-					bestResults[lap.CustID][sessionDetails.EventGroupId] = make(map[string]int)
-				}
-				// 3. Add the result to the date if it does not exist or if it is better than the previous one
-				if oldResult, ok := bestResults[lap.CustID][sessionDetails.EventGroupId][sessionDetails.Date]; !ok {
-					bestResults[lap.CustID][sessionDetails.EventGroupId][sessionDetails.Date] = averageTime
-				} else {
-					if oldResult > averageTime {
-						bestResults[lap.CustID][sessionDetails.EventGroupId][sessionDetails.Date] = averageTime
-					}
-				}
-			}
-		} else {
-			stintValidLaps = 0
-			stintEnd = true
-		}
-	}
-
-	// Generate the ranking
-	ranking := make([]*Rank, 0)
-	for _, driver := range drivers {
-		driverRank := &Rank{
-			CustId:  driver.IRacingCustId,
-			Sum:     0,
-			IsValid: true,
-			Results: bestResults[driver.IRacingCustId], // TODO: add default value, it might be null
-		}
-
-		driverBestResults, ok := bestResults[driver.IRacingCustId]
-		if ok {
-			for _, eventGroup := range eventGroups {
-				if driverBestGroupResults, ok := driverBestResults[eventGroup.ID]; !ok {
-					// If the driver did not participate in the event group, the result is 0
-					driverRank.IsValid = false
-				} else {
-					// Check if the driver has at least a result in one date of the event group and in case add the best result
-					bestResult := 0
-					for _, result := range driverBestGroupResults {
-						if bestResult == 0 || result < bestResult {
-							bestResult = result
-						}
-					}
-
-					if bestResult > 0 {
-						driverRank.Sum += bestResult
-					} else {
-						driverRank.IsValid = false
-					}
-				}
-			}
-		}
-
-		if driverRank.Sum == 0 {
-			driverRank.IsValid = false
-		}
-
-		ranking = append(ranking, driverRank)
-	}
-
-	// Sort the ranking by sum. First the valid ones, then the invalid ones and the ones with 0 sum
-	sort.Slice(ranking, func(i, j int) bool {
-		if ranking[i].IsValid != ranking[j].IsValid {
-			return ranking[i].IsValid
-		}
-		if ranking[i].Sum == 0 {
-			return false
-		}
-		if ranking[j].Sum == 0 {
-			return true
-		}
-		return ranking[i].Sum < ranking[j].Sum
-	})
-
-	for i, driver := range ranking {
-		driver.Pos = i + 1
-
-		if !driver.IsValid {
-			driver.Sum = 0
-		}
-	}
-
 	// Return the response
 	driversInfo := make(map[int]*DriverInfo)
 	for _, driver := range drivers {
@@ -341,6 +231,8 @@ func CompetitionRankingHandler(c *gin.Context, eventsDb *gorm.DB, carsDb *gorm.D
 			Name:    eventGroup.Name,
 			TrackId: eventGroup.IRacingTrackId,
 			Dates:   eventGroup.Dates,
+			Mode:    competitionRanking.result.EventGroupRules[eventGroup.ID].Mode,
+			Laps:    competitionRanking.result.EventGroupRules[eventGroup.ID].StintLaps,
 		}
 
 		eventGroupsInfo = append(eventGroupsInfo, eventGroupInfo)
@@ -350,6 +242,20 @@ func CompetitionRankingHandler(c *gin.Context, eventsDb *gorm.DB, carsDb *gorm.D
 		Id:               competition.ID,
 		Name:             competition.Name,
 		CrewDriversCount: competition.CrewDriversCount,
+		LeagueId:         competition.LeagueID,
+		SeasonId:         competition.SeasonID,
+		CarCategory:      competition.CarCategory,
+		Rules:            newRulesInfo(competitionRanking.result.Rules),
+	}
+
+	// Add the drivers stats, if requested
+	var strengthInfo *StrengthInfo
+	if c.Query("stats") == "true" {
+		strengthInfo, err = addDriversStats(driversDb, competition.CarCategory, driversInfo)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting drivers stats"})
+			return
+		}
 	}
 
 	classesInfo := make([]*ClassInfo, len(classes))
@@ -364,149 +270,337 @@ func CompetitionRankingHandler(c *gin.Context, eventsDb *gorm.DB, carsDb *gorm.D
 
 	response := RankingResponse{
 		Classes:     classesInfo,
-		Ranking:     ranking,
+		Ranking:     competitionRanking.result.Ranking,
 		EventGroups: eventGroupsInfo,
 		Drivers:     driversInfo,
 		Competition: competitionInfo,
+		Strength:    strengthInfo,
 	}
 
 	c.JSON(http.StatusOK, response)
 }
 
-func CompetitionCsvHandler(c *gin.Context, eventsDb *gorm.DB) {
-	// Get the competition
-	competition, err := logic.GetCompetitionBySlug(eventsDb, c.Param("id"))
+// addDriversStats adds to the drivers their current stats in the car category and their location,
+// and returns the average iRatings. The drivers without stats are not included in the averages.
+func addDriversStats(driversDb *gorm.DB, carCategory string, driversInfo map[int]*DriverInfo) (*StrengthInfo, error) {
+	custIds := make([]int, 0, len(driversInfo))
+	for custId := range driversInfo {
+		custIds = append(custIds, custId)
+	}
+
+	strengthInfo := &StrengthInfo{
+		CarCategory: carCategory,
+		Teams:       map[uint]int{},
+		Crews:       map[uint]int{},
+		Classes:     map[uint]int{},
+	}
+	if len(custIds) == 0 {
+		return strengthInfo, nil
+	}
+
+	stats, err := logic.GetDriversCategoryStats(driversDb, custIds, carCategory)
 	if err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Competition not found"})
-			return
-		} else {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting competition"})
-			return
+		return nil, err
+	}
+
+	drivers, err := logic.GetDrivers(driversDb, custIds)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, driver := range drivers {
+		driversInfo[driver.CustID].Location = driver.Location
+	}
+
+	var all averageIRating
+	teams := make(map[uint]*averageIRating)
+	crews := make(map[uint]*averageIRating)
+	classes := make(map[uint]*averageIRating)
+	add := func(averages map[uint]*averageIRating, id uint, iRating int) {
+		if _, ok := averages[id]; !ok {
+			averages[id] = &averageIRating{}
+		}
+		averages[id].add(iRating)
+	}
+
+	for custId, driverInfo := range driversInfo {
+		driverStats, ok := stats[custId]
+		if !ok {
+			continue
+		}
+
+		driverInfo.IRating = driverStats.IRating
+		driverInfo.License = driverStats.License
+		driverInfo.LicenseClass = driverStats.LicenseClass
+		driverInfo.SafetyRating = driverStats.SafetyRating
+
+		all.add(driverStats.IRating)
+		add(crews, driverInfo.Crew.Id, driverStats.IRating)
+		// The crews without a team or a class are not grouped together
+		if driverInfo.Crew.Team.Id != 0 {
+			add(teams, driverInfo.Crew.Team.Id, driverStats.IRating)
 		}
+		if driverInfo.Crew.ClassId != 0 {
+			add(classes, driverInfo.Crew.ClassId, driverStats.IRating)
+		}
+	}
+
+	strengthInfo.AvgIRating = all.value()
+	for id, average := range teams {
+		strengthInfo.Teams[id] = average.value()
+	}
+	for id, average := range crews {
+		strengthInfo.Crews[id] = average.value()
+	}
+	for id, average := range classes {
+		strengthInfo.Classes[id] = average.value()
+	}
+
+	return strengthInfo, nil
+}
+
+type averageIRating struct {
+	sum   int
+	count int
+}
+
+func (a *averageIRating) add(iRating int) {
+	a.sum += iRating
+	a.count++
+}
+
+// value returns the rounded average, 0 if there are no values.
+func (a *averageIRating) value() int {
+	if a.count == 0 {
+		return 0
 	}
 
+	return (a.sum + a.count/2) / a.count
+}
+
+type competitionRanking struct {
+	sessions    []*logic.CompetitionSession
+	drivers     []*events_models.CompetitionDriver
+	eventGroups []*events_models.EventGroup
+	result      *ranking.Result
+}
+
+// computeCompetitionRanking gets the sessions, the drivers, the event groups and the laps of the competition
+// and computes its ranking with the qualifying rules of the competition.
+func computeCompetitionRanking(eventsDb *gorm.DB, competition *events_models.Competition) (*competitionRanking, error) {
+	competitionId := competition.ID
+
 	// Get the sessions valid for the competition
-	sessions, sessionsMap, err := logic.GetCompetitionSessions(eventsDb, competition.ID)
+	sessions, _, err := logic.GetCompetitionSessions(eventsDb, competitionId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting competition sessions"})
-		return
+		return nil, err
+	}
+
+	// Get event groups
+	eventGroups, err := logic.GetEventGroups(eventsDb, competitionId)
+	if err != nil {
+		return nil, err
 	}
 
 	// Get drivers
-	drivers, _, err := logic.GetCompetitionDrivers(eventsDb, competition.ID)
+	drivers, _, err := logic.GetCompetitionDrivers(eventsDb, competitionId)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting competition drivers"})
-		return
+		return nil, err
 	}
 
-	driverCars := make(map[int]int)
-	for _, driver := range drivers {
-		driverCars[driver.IRacingCustId] = driver.Crew.IRacingCarId
+	// The sessions in position mode need only the finishing positions of the participants,
+	// the other ones only the laps
+	eventGroupModes := make(map[uint]string)
+	for _, eventGroup := range eventGroups {
+		eventGroupModes[eventGroup.ID] = eventGroup.QualifyingMode
+		if eventGroup.QualifyingMode == "" {
+			eventGroupModes[eventGroup.ID] = competition.QualifyingRules.Mode
+		}
 	}
 
-	// Get laps
-	var simsessionIds [][]int
+	var lapsSimsessionIds, positionsSimsessionIds [][]int
 	for _, session := range sessions {
-		simsessionIds = append(simsessionIds, []int{session.SubsessionId, session.SimsessionNumber})
+		simsessionId := []int{session.SubsessionId, session.SimsessionNumber}
+		if eventGroupModes[session.EventGroupId] == ranking.ModePosition {
+			positionsSimsessionIds = append(positionsSimsessionIds, simsessionId)
+		} else {
+			lapsSimsessionIds = append(lapsSimsessionIds, simsessionId)
+		}
 	}
 
-	laps, err := logic.GetLaps(eventsDb, simsessionIds)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting laps"})
-		return
+	// Get laps
+	var laps []*events_models.Lap
+	if len(lapsSimsessionIds) > 0 {
+		laps, err = logic.GetLaps(eventsDb, lapsSimsessionIds)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Get the participants, for the finishing positions
+	var participants []*events_models.SessionSimsessionParticipant
+	if len(positionsSimsessionIds) > 0 {
+		participants, err = logic.GetSimsessionsParticipants(eventsDb, positionsSimsessionIds)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Analyze
-	allResults := make(map[int]map[int]int)
-	bestResults := make(map[int]map[uint]map[string]int) // Customer ID, Group, Date, average ms
-
-	currentCustId := 0
-	currentSubsessionId := 0
-	stintEnd := false
-	stintValidLaps := 0
-	stintTimeSum := 0
-
-	for _, lap := range laps {
-		// Check the first key of driverResults
-		if lap.CustID != currentCustId {
-			allResults[lap.CustID] = make(map[int]int)
-			currentCustId = lap.CustID
-			stintEnd = false
-			stintValidLaps = 0
-			stintTimeSum = 0
+	rankingSessions := make([]*ranking.Session, len(sessions))
+	for i, session := range sessions {
+		rankingSessions[i] = &ranking.Session{
+			SubsessionId: session.SubsessionId,
+			EventGroupId: session.EventGroupId,
+			Date:         session.Date,
 		}
+	}
 
-		if lap.SubsessionID != currentSubsessionId {
-			allResults[lap.CustID][lap.SubsessionID] = 0
-			currentSubsessionId = lap.SubsessionID
-			stintEnd = false
-			stintValidLaps = 0
-			stintTimeSum = 0
+	rankingDrivers := make([]*ranking.Driver, len(drivers))
+	for i, driver := range drivers {
+		rankingDrivers[i] = &ranking.Driver{
+			CustId: driver.IRacingCustId,
+			CarId:  driver.Crew.IRacingCarId,
 		}
+	}
 
-		driverCar, ok := driverCars[lap.CustID]
-		if !ok {
-			continue
+	rankingLaps := make([]*ranking.Lap, len(laps))
+	for i, lap := range laps {
+		rankingLaps[i] = &ranking.Lap{
+			CustId:       lap.CustID,
+			SubsessionId: lap.SubsessionID,
+			CarId:        lap.SessionSimsessionParticipant.CarID,
+			LapNumber:    lap.LapNumber,
+			LapTime:      lap.LapTime,
+			LapEvents:    lap.LapEvents,
+			Incident:     lap.Incident,
 		}
+	}
 
-		if driverCar != lap.SessionSimsessionParticipant.CarID {
-			continue
+	rankingParticipants := make([]*ranking.Participant, len(participants))
+	for i, participant := range participants {
+		rankingParticipants[i] = &ranking.Participant{
+			CustId:         participant.CustID,
+			SubsessionId:   participant.SubsessionID,
+			CarId:          participant.CarID,
+			FinishPosition: participant.FinishPosition,
 		}
+	}
 
-		if stintEnd {
-			continue
+	rankingEventGroups := make([]*ranking.EventGroup, len(eventGroups))
+	for i, eventGroup := range eventGroups {
+		rankingEventGroups[i] = &ranking.EventGroup{
+			Id:        eventGroup.ID,
+			Mode:      eventGroup.QualifyingMode,
+			StintLaps: eventGroup.QualifyingLaps,
 		}
+	}
 
-		if logic.IsLapPitted(lap.LapEvents) {
-			if stintValidLaps > 0 {
-				stintEnd = true
-			}
+	result, err := ranking.Compute(rankingLaps, rankingParticipants, rankingSessions, rankingDrivers, rankingEventGroups, newRankingRules(competition.QualifyingRules))
+	if err != nil {
+		return nil, err
+	}
 
-			continue
-		}
+	return &competitionRanking{
+		sessions:    sessions,
+		drivers:     drivers,
+		eventGroups: eventGroups,
+		result:      result,
+	}, nil
+}
 
-		if logic.IsLapValid(lap.LapNumber, lap.LapTime, lap.LapEvents, lap.Incident) {
-			stintValidLaps++
-			stintTimeSum += lap.LapTime
-
-			if stintValidLaps == 3 {
-				stintEnd = true
-
-				averageTime := stintTimeSum / 3 / 10
-
-				// Store the average time of the session for the driver (only valid stints)
-				allResults[lap.CustID][lap.SubsessionID] = averageTime
-
-				// Store the best result of the driver for the date in the event group (only valid stints)
-				sessionDetails := sessionsMap[lap.SubsessionID]
-				// 1. Add the customer to the map if it does not exist
-				if _, ok := bestResults[lap.CustID]; !ok {
-					bestResults[lap.CustID] = make(map[uint]map[string]int)
-				}
-				// 2. Add the event group to the map if it does not exist
-				if _, ok := bestResults[lap.CustID][sessionDetails.EventGroupId]; !ok {
-					bestResults[lap.CustID][sessionDetails.EventGroupId] = make(map[string]int)
-				}
-				// 3. Add the result to the date if it does not exist or if it is better than the previous one
-				if oldResult, ok := bestResults[lap.CustID][sessionDetails.EventGroupId][sessionDetails.Date]; !ok {
-					bestResults[lap.CustID][sessionDetails.EventGroupId][sessionDetails.Date] = averageTime
-				} else {
-					if oldResult > averageTime {
-						bestResults[lap.CustID][sessionDetails.EventGroupId][sessionDetails.Date] = averageTime
-					}
-				}
-			}
+func newRankingRules(rules events_models.QualifyingRules) ranking.Rules {
+	return ranking.Rules{
+		StintLaps:        rules.Laps,
+		Mode:             rules.Mode,
+		DisallowedEvents: rules.DisallowedEvents,
+		AllowedEvents:    rules.AllowedEvents,
+		AllowIncidents:   rules.AllowIncidents,
+		RestartAfterPit:  rules.RestartAfterPit,
+		SkipOutLap:       rules.SkipOutLap,
+		Resolution:       rules.Resolution,
+		RoundTimes:       rules.RoundTimes,
+	}
+}
+
+func CompetitionCsvHandler(c *gin.Context, eventsDb *gorm.DB) {
+	// Get the competition
+	competition, err := logic.GetCompetitionBySlug(eventsDb, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Competition not found"})
+			return
 		} else {
-			stintValidLaps = 0
-			stintEnd = true
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting competition"})
+			return
 		}
 	}
 
+	// Compute the ranking
+	competitionRanking, err := computeCompetitionRanking(eventsDb, competition)
+	if err != nil {
+		if errors.Is(err, ranking.ErrUnknownPositions) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Missing finishing positions, the sessions must be downloaded again"})
+			return
+		}
+
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error computing the ranking"})
+		return
+	}
+
 	// Generate CSV
-	csv := logic.GenerateSessionsCsv(sessions, drivers, allResults)
+	csv := logic.GenerateSessionsCsv(competitionRanking.sessions, competitionRanking.drivers, competitionRanking.result.SessionResults, competitionRanking.result.EventGroupRules)
 
 	c.Header("Content-Description", "File Transfer")
 	c.Header("Content-Disposition", "attachment; filename=sessions.csv")
 	c.Data(http.StatusOK, "text/csv", []byte(csv))
 }
+
+func CompetitionCalendarHandler(c *gin.Context, eventsDb *gorm.DB) {
+	// Get the competition
+	competition, err := logic.GetCompetitionBySlug(eventsDb, c.Param("id"))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Competition not found"})
+			return
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting competition"})
+			return
+		}
+	}
+
+	// Get the scheduled sessions of the season, including the future ones
+	sessions, err := logic.GetSeasonSessions(eventsDb, competition.LeagueID, competition.SeasonID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting season sessions"})
+		return
+	}
+
+	// Return the response
+	calendar := make([]*CalendarSessionInfo, len(sessions))
+	for i, session := range sessions {
+		carIds := session.CarIDs
+		if carIds == nil {
+			carIds = []int64{}
+		}
+
+		calendar[i] = &CalendarSessionInfo{
+			SessionId:         session.SessionID,
+			SubsessionId:      session.SubsessionID,
+			LaunchAt:          session.LaunchAt,
+			TrackId:           session.TrackID,
+			TrackName:         session.TrackName,
+			TrackConfigName:   session.TrackConfigName,
+			CarIds:            carIds,
+			PracticeLength:    session.PracticeLength,
+			QualifyLength:     session.QualifyLength,
+			QualifyLaps:       session.QualifyLaps,
+			RaceLength:        session.RaceLength,
+			RaceLaps:          session.RaceLaps,
+			PasswordProtected: session.PasswordProtected,
+			HasResults:        session.HasResults,
+		}
+	}
+
+	c.JSON(http.StatusOK, calendar)
+}
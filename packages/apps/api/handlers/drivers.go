@@ -0,0 +1,442 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/api/logic"
+	"riccardotornesello.it/sharedtelemetry/iracing/drivers_models"
+)
+
+type DriverStatsHistoryResponse struct {
+	CustId     int                            `json:"custId"`
+	Categories map[string][]*DriverStatsPoint `json:"categories"`
+}
+
+type DriverStatsResponse struct {
+	CustId     int                          `json:"custId"`
+	At         time.Time                    `json:"at"`
+	Categories map[string]*DriverStatsPoint `json:"categories"`
+}
+
+type DriverStatsPoint struct {
+	RecordedAt   time.Time `json:"recordedAt"`
+	IRating      int       `json:"iRating"`
+	License      string    `json:"license"`
+	LicenseClass string    `json:"licenseClass"`
+	SafetyRating *float64  `json:"safetyRating"`
+}
+
+func newDriverStatsPoint(stats *drivers_models.DriverStatsHistory) *DriverStatsPoint {
+	return &DriverStatsPoint{
+		RecordedAt:   stats.RecordedAt,
+		IRating:      stats.IRating,
+		License:      stats.License,
+		LicenseClass: stats.LicenseClass,
+		SafetyRating: stats.SafetyRating,
+	}
+}
+
+// parseTimeQuery parses an optional query parameter as a date (YYYY-MM-DD) or a RFC 3339 time.
+// A date is parsed as the end of the day, to include the snapshots of the whole day.
+func parseTimeQuery(c *gin.Context, name string) (*time.Time, error) {
+	value := c.Query(name)
+	if value == "" {
+		return nil, nil
+	}
+
+	if date, err := time.Parse(time.DateOnly, value); err == nil {
+		endOfDay := date.Add(24*time.Hour - time.Nanosecond)
+		return &endOfDay, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &t, nil
+}
+
+// parseSinceQuery parses an optional query parameter as a date (YYYY-MM-DD), from the start of the day,
+// or a RFC 3339 time.
+func parseSinceQuery(c *gin.Context, name string) (*time.Time, error) {
+	if date, err := time.Parse(time.DateOnly, c.Query(name)); err == nil {
+		return &date, nil
+	}
+
+	return parseTimeQuery(c, name)
+}
+
+func DriverStatsHistoryHandler(c *gin.Context, driversDb *gorm.DB) {
+	custId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid driver ID"})
+		return
+	}
+
+	from, err := parseTimeQuery(c, "from")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid from date"})
+		return
+	}
+
+	to, err := parseTimeQuery(c, "to")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid to date"})
+		return
+	}
+
+	history, err := logic.GetDriverStatsHistory(driversDb, custId, c.Query("category"), from, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting driver stats history"})
+		return
+	}
+
+	// Return the response
+	categories := make(map[string][]*DriverStatsPoint)
+	for _, stats := range history {
+		categories[stats.CarCategory] = append(categories[stats.CarCategory], newDriverStatsPoint(stats))
+	}
+
+	c.JSON(http.StatusOK, DriverStatsHistoryResponse{
+		CustId:     custId,
+		Categories: categories,
+	})
+}
+
+func DriverStatsHandler(c *gin.Context, driversDb *gorm.DB) {
+	custId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid driver ID"})
+		return
+	}
+
+	// The current stats are returned if no time is specified
+	at, err := parseTimeQuery(c, "at")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid at date"})
+		return
+	}
+	if at == nil {
+		now := time.Now()
+		at = &now
+	}
+
+	stats, err := logic.GetDriverStatsAt(driversDb, custId, *at)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting driver stats"})
+		return
+	}
+
+	// Return the response
+	categories := make(map[string]*DriverStatsPoint)
+	for _, categoryStats := range stats {
+		categories[categoryStats.CarCategory] = newDriverStatsPoint(categoryStats)
+	}
+
+	c.JSON(http.StatusOK, DriverStatsResponse{
+		CustId:     custId,
+		At:         *at,
+		Categories: categories,
+	})
+}
+
+const (
+	minSearchLength    = 2
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxLookupDrivers   = 1000
+
+	// The period of the changes returned if not specified
+	defaultChangesPeriod = 30 * 24 * time.Hour
+)
+
+type DriverSummary struct {
+	CustId       int        `json:"custId"`
+	Name         string     `json:"name"`
+	Location     string     `json:"location"`
+	ClubName     string     `json:"clubName"`
+	MissingSince *time.Time `json:"missingSince,omitempty"`
+}
+
+type DriverResponse struct {
+	DriverSummary
+	Stats map[string]*DriverCategoryStats `json:"stats"`
+}
+
+type DriverCategoryStats struct {
+	License           string    `json:"license"`
+	LicenseClass      string    `json:"licenseClass"`
+	SafetyRating      *float64  `json:"safetyRating"`
+	IRating           int       `json:"iRating"`
+	TTRating          int       `json:"ttRating"`
+	Starts            int       `json:"starts"`
+	Wins              int       `json:"wins"`
+	AvgStartPosition  float64   `json:"avgStartPosition"`
+	AvgFinishPosition float64   `json:"avgFinishPosition"`
+	AvgPoints         float64   `json:"avgPoints"`
+	Top25Percent      int       `json:"top25Percent"`
+	Laps              int       `json:"laps"`
+	LapsLed           int       `json:"lapsLed"`
+	AvgIncidents      float64   `json:"avgIncidents"`
+	ClubPoints        int       `json:"clubPoints"`
+	ChampPoints       int       `json:"champPoints"`
+	UpdatedAt         time.Time `json:"updatedAt"`
+}
+
+type DriversLookupRequest struct {
+	CustIds []int `json:"custIds"`
+}
+
+type DriversLookupResponse struct {
+	Drivers []*DriverResponse `json:"drivers"`
+	Missing []int             `json:"missing"`
+}
+
+type DriverNameChange struct {
+	CustId       int       `json:"custId"`
+	ChangedAt    time.Time `json:"changedAt"`
+	PreviousName string    `json:"previousName"`
+	Name         string    `json:"name"`
+}
+
+type DriversChangesResponse struct {
+	Since   time.Time          `json:"since"`
+	Renamed []DriverNameChange `json:"renamed"`
+	Missing []DriverSummary    `json:"missing"`
+}
+
+func newDriverSummary(driver *drivers_models.Driver) DriverSummary {
+	return DriverSummary{
+		CustId:       driver.CustID,
+		Name:         driver.Name,
+		Location:     driver.Location,
+		ClubName:     driver.ClubName,
+		MissingSince: driver.MissingSince,
+	}
+}
+
+func newDriverNameChanges(changes []*drivers_models.DriverNameChange) []DriverNameChange {
+	response := make([]DriverNameChange, len(changes))
+	for i, change := range changes {
+		response[i] = DriverNameChange{
+			CustId:       change.CustID,
+			ChangedAt:    change.ChangedAt,
+			PreviousName: change.PreviousName,
+			Name:         change.Name,
+		}
+	}
+
+	return response
+}
+
+func newDriverResponse(driver *drivers_models.Driver, stats []*drivers_models.DriverStats) *DriverResponse {
+	categories := make(map[string]*DriverCategoryStats)
+	for _, categoryStats := range stats {
+		categories[categoryStats.CarCategory] = &DriverCategoryStats{
+			License:           categoryStats.License,
+			LicenseClass:      categoryStats.LicenseClass,
+			SafetyRating:      categoryStats.SafetyRating,
+			IRating:           categoryStats.IRating,
+			TTRating:          categoryStats.TTRating,
+			Starts:            categoryStats.Starts,
+			Wins:              categoryStats.Wins,
+			AvgStartPosition:  categoryStats.AvgStartPosition,
+			AvgFinishPosition: categoryStats.AvgFinishPosition,
+			AvgPoints:         categoryStats.AvgPoints,
+			Top25Percent:      categoryStats.Top25Percent,
+			Laps:              categoryStats.Laps,
+			LapsLed:           categoryStats.LapsLed,
+			AvgIncidents:      categoryStats.AvgIncidents,
+			ClubPoints:        categoryStats.ClubPoints,
+			ChampPoints:       categoryStats.ChampPoints,
+			UpdatedAt:         categoryStats.UpdatedAt,
+		}
+	}
+
+	return &DriverResponse{
+		DriverSummary: newDriverSummary(driver),
+		Stats:         categories,
+	}
+}
+
+func DriversSearchHandler(c *gin.Context, driversDb *gorm.DB) {
+	query := c.Query("q")
+	if len([]rune(query)) < minSearchLength {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The search must be at least 2 characters long"})
+		return
+	}
+
+	limit := defaultSearchLimit
+	if c.Query("limit") != "" {
+		var err error
+		limit, err = strconv.Atoi(c.Query("limit"))
+		if err != nil || limit < 1 || limit > maxSearchLimit {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+	}
+
+	drivers, err := logic.SearchDrivers(driversDb, query, c.Query("location"), limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error searching drivers"})
+		return
+	}
+
+	// Return the response
+	response := make([]DriverSummary, len(drivers))
+	for i, driver := range drivers {
+		response[i] = newDriverSummary(driver)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func DriverHandler(c *gin.Context, driversDb *gorm.DB) {
+	custId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid driver ID"})
+		return
+	}
+
+	drivers, stats, err := getDriversWithStats(driversDb, []int{custId})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting driver"})
+		return
+	}
+	if len(drivers) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Driver not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newDriverResponse(drivers[0], stats[custId]))
+}
+
+func DriversLookupHandler(c *gin.Context, driversDb *gorm.DB) {
+	var request DriversLookupRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+	if len(request.CustIds) > maxLookupDrivers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many drivers"})
+		return
+	}
+
+	drivers, stats, err := getDriversWithStats(driversDb, request.CustIds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting drivers"})
+		return
+	}
+
+	// Return the response, with the requested IDs not found
+	found := make(map[int]bool)
+	response := DriversLookupResponse{
+		Drivers: make([]*DriverResponse, len(drivers)),
+		Missing: []int{},
+	}
+	for i, driver := range drivers {
+		found[driver.CustID] = true
+		response.Drivers[i] = newDriverResponse(driver, stats[driver.CustID])
+	}
+	for _, custId := range request.CustIds {
+		if !found[custId] {
+			found[custId] = true
+			response.Missing = append(response.Missing, custId)
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func getDriversWithStats(driversDb *gorm.DB, custIds []int) ([]*drivers_models.Driver, map[int][]*drivers_models.DriverStats, error) {
+	if len(custIds) == 0 {
+		return nil, nil, nil
+	}
+
+	drivers, err := logic.GetDrivers(driversDb, custIds)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stats, err := logic.GetDriversCurrentStats(driversDb, custIds)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return drivers, stats, nil
+}
+
+func DriverNameChangesHandler(c *gin.Context, driversDb *gorm.DB) {
+	custId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid driver ID"})
+		return
+	}
+
+	changes, err := logic.GetDriverNameChanges(driversDb, custId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting driver name changes"})
+		return
+	}
+
+	c.JSON(http.StatusOK, newDriverNameChanges(changes))
+}
+
+func DriversChangesHandler(c *gin.Context, driversDb *gorm.DB) {
+	since, err := parseSinceQuery(c, "since")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid since date"})
+		return
+	}
+	if since == nil {
+		defaultSince := time.Now().Add(-defaultChangesPeriod)
+		since = &defaultSince
+	}
+
+	// The changes can be limited to some drivers, e.g. the ones of a league
+	var custIds []int
+	if c.Query("custIds") != "" {
+		for _, value := range strings.Split(c.Query("custIds"), ",") {
+			custId, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid driver ID"})
+				return
+			}
+			custIds = append(custIds, custId)
+		}
+	}
+	if len(custIds) > maxLookupDrivers {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Too many drivers"})
+		return
+	}
+
+	nameChanges, err := logic.GetNameChangesSince(driversDb, *since, custIds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting name changes"})
+		return
+	}
+
+	missingDrivers, err := logic.GetMissingDriversSince(driversDb, *since, custIds)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting missing drivers"})
+		return
+	}
+
+	// Return the response
+	response := DriversChangesResponse{
+		Since:   *since,
+		Renamed: newDriverNameChanges(nameChanges),
+		Missing: make([]DriverSummary, len(missingDrivers)),
+	}
+	for i, driver := range missingDrivers {
+		response.Missing[i] = newDriverSummary(driver)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/api/logic"
+)
+
+type LeagueResponse struct {
+	Id          int                 `json:"id"`
+	Name        string              `json:"name"`
+	OwnerCustId int                 `json:"ownerCustId"`
+	OwnerName   string              `json:"ownerName"`
+	About       string              `json:"about"`
+	Url         string              `json:"url"`
+	SmallLogo   string              `json:"smallLogo"`
+	LargeLogo   string              `json:"largeLogo"`
+	RosterCount int                 `json:"rosterCount"`
+	Rules       string              `json:"rules"`
+	Seasons     []*LeagueSeasonInfo `json:"seasons"`
+}
+
+type LeagueSeasonInfo struct {
+	Id               int    `json:"id"`
+	Name             string `json:"name"`
+	Active           bool   `json:"active"`
+	PointsSystemName string `json:"pointsSystemName"`
+}
+
+func LeagueHandler(c *gin.Context, eventsDb *gorm.DB) {
+	leagueId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid league ID"})
+		return
+	}
+
+	// Get the league
+	league, err := logic.GetLeague(eventsDb, leagueId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "League not found"})
+			return
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting league"})
+			return
+		}
+	}
+
+	// Get the visible seasons
+	seasons, err := logic.GetLeagueSeasons(eventsDb, leagueId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting league seasons"})
+		return
+	}
+
+	// Return the response
+	seasonsInfo := make([]*LeagueSeasonInfo, len(seasons))
+	for i, season := range seasons {
+		seasonsInfo[i] = &LeagueSeasonInfo{
+			Id:               season.SeasonID,
+			Name:             season.Name,
+			Active:           season.Active,
+			PointsSystemName: season.PointsSystemName,
+		}
+	}
+
+	response := LeagueResponse{
+		Id:          league.LeagueID,
+		Name:        league.Name,
+		OwnerCustId: league.OwnerCustID,
+		OwnerName:   league.OwnerName,
+		About:       league.About,
+		Url:         league.URL,
+		SmallLogo:   league.SmallLogo,
+		LargeLogo:   league.LargeLogo,
+		RosterCount: league.RosterCount,
+		Rules:       league.Rules,
+		Seasons:     seasonsInfo,
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/api/logic"
+	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
+)
+
+type SeasonStatusResponse struct {
+	LeagueId      int                  `json:"leagueId"`
+	SeasonId      int                  `json:"seasonId"`
+	Status        string               `json:"status"`
+	QueuedAt      *time.Time           `json:"queuedAt"`
+	StartedAt     *time.Time           `json:"startedAt"`
+	LastSyncAt    *time.Time           `json:"lastSyncAt"`
+	LastSyncError string               `json:"lastSyncError"`
+	NextSyncAt    *time.Time           `json:"nextSyncAt"`
+	UpToDate      bool                 `json:"upToDate"`
+	SessionsCount map[string]int       `json:"sessionsCount"`
+	Sessions      []*SessionStatusInfo `json:"sessions"`
+}
+
+type SessionStatusInfo struct {
+	SubsessionId      int        `json:"subsessionId"`
+	Status            string     `json:"status"`
+	LaunchAt          *time.Time `json:"launchAt"`
+	QueuedAt          *time.Time `json:"queuedAt"`
+	DownloadStartedAt *time.Time `json:"downloadStartedAt"`
+	ParsedAt          *time.Time `json:"parsedAt"`
+	FailedAt          *time.Time `json:"failedAt"`
+	Error             string     `json:"error"`
+}
+
+func newSessionStatusInfo(session *events_models.Session) *SessionStatusInfo {
+	// The launch time is known only after the session is parsed
+	var launchAt *time.Time
+	if !session.LaunchAt.IsZero() {
+		launchAt = &session.LaunchAt
+	}
+
+	return &SessionStatusInfo{
+		SubsessionId:      session.SubsessionID,
+		Status:            session.Status,
+		LaunchAt:          launchAt,
+		QueuedAt:          session.QueuedAt,
+		DownloadStartedAt: session.DownloadStartedAt,
+		ParsedAt:          session.ParsedAt,
+		FailedAt:          session.FailedAt,
+		Error:             session.Error,
+	}
+}
+
+func SeasonStatusHandler(c *gin.Context, eventsDb *gorm.DB) {
+	leagueId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid league ID"})
+		return
+	}
+
+	seasonId, err := strconv.Atoi(c.Param("seasonId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid season ID"})
+		return
+	}
+
+	// Get the season
+	season, err := logic.GetLeagueSeason(eventsDb, leagueId, seasonId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Season not found"})
+			return
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting season"})
+			return
+		}
+	}
+
+	// Get the subsessions of the season
+	sessions, err := logic.GetSeasonIngestedSessions(eventsDb, leagueId, seasonId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting season sessions"})
+		return
+	}
+
+	// Return the response.
+	// The standings are up to date when the last sync succeeded and all its subsessions are parsed.
+	sessionsCount := map[string]int{
+		events_models.IngestionStatusQueued:      0,
+		events_models.IngestionStatusDownloading: 0,
+		events_models.IngestionStatusParsed:      0,
+		events_models.IngestionStatusFailed:      0,
+	}
+	sessionsInfo := make([]*SessionStatusInfo, len(sessions))
+	for i, session := range sessions {
+		sessionsCount[session.Status]++
+		sessionsInfo[i] = newSessionStatusInfo(session)
+	}
+
+	upToDate := season.SyncStatus == events_models.IngestionStatusParsed && sessionsCount[events_models.IngestionStatusParsed] == len(sessions)
+
+	response := SeasonStatusResponse{
+		LeagueId:      season.LeagueID,
+		SeasonId:      season.SeasonID,
+		Status:        season.SyncStatus,
+		QueuedAt:      season.SyncQueuedAt,
+		StartedAt:     season.SyncStartedAt,
+		LastSyncAt:    season.LastSyncAt,
+		LastSyncError: season.LastSyncError,
+		NextSyncAt:    season.NextSyncAt,
+		UpToDate:      upToDate,
+		SessionsCount: sessionsCount,
+		Sessions:      sessionsInfo,
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func SessionStatusHandler(c *gin.Context, eventsDb *gorm.DB) {
+	subsessionId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid subsession ID"})
+		return
+	}
+
+	session, err := logic.GetSession(eventsDb, subsessionId)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+			return
+		} else {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error getting session"})
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, newSessionStatusInfo(session))
+}
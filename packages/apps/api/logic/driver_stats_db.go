@@ -0,0 +1,100 @@
+package logic
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/drivers_models"
+)
+
+// GetDriverStatsHistory returns the snapshots of the stats of a driver, ordered by car category and time.
+// The category and the time range are optional.
+func GetDriverStatsHistory(db *gorm.DB, custId int, carCategory string, from *time.Time, to *time.Time) ([]*drivers_models.DriverStatsHistory, error) {
+	query := db.Where("cust_id = ?", custId)
+	if carCategory != "" {
+		query = query.Where("car_category = ?", carCategory)
+	}
+	if to != nil {
+		query = query.Where("recorded_at <= ?", *to)
+	}
+
+	// The last snapshot before the range is included, as it is still valid at its start
+	if from != nil {
+		query = query.Where(`recorded_at >= COALESCE((
+			SELECT MAX(previous.recorded_at)
+			FROM driver_stats_histories AS previous
+			WHERE previous.cust_id = driver_stats_histories.cust_id
+			AND previous.car_category = driver_stats_histories.car_category
+			AND previous.recorded_at <= ?
+		), ?)`, *from, *from)
+	}
+
+	var history []*drivers_models.DriverStatsHistory
+	err := query.Order("car_category, recorded_at").Find(&history).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// GetDriversStatsAt returns the stats valid at the given time of the drivers in a car category,
+// by customer ID. The drivers without stats at that time are not included.
+func GetDriversStatsAt(db *gorm.DB, custIds []int, carCategory string, at time.Time) (map[int]*drivers_models.DriverStatsHistory, error) {
+	var stats []*drivers_models.DriverStatsHistory
+	err := db.
+		Select("DISTINCT ON (cust_id) *").
+		Where("cust_id IN ?", custIds).
+		Where("car_category = ?", carCategory).
+		Where("recorded_at <= ?", at).
+		Order("cust_id, recorded_at DESC").
+		Find(&stats).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	statsMap := make(map[int]*drivers_models.DriverStatsHistory)
+	for _, stat := range stats {
+		statsMap[stat.CustID] = stat
+	}
+
+	return statsMap, nil
+}
+
+// GetDriverStatsAt returns the stats of a driver valid at the given time, one for each car category.
+func GetDriverStatsAt(db *gorm.DB, custId int, at time.Time) ([]*drivers_models.DriverStatsHistory, error) {
+	var stats []*drivers_models.DriverStatsHistory
+	err := db.
+		Select("DISTINCT ON (car_category) *").
+		Where("cust_id = ?", custId).
+		Where("recorded_at <= ?", at).
+		Order("car_category, recorded_at DESC").
+		Find(&stats).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
+
+// GetDriversCategoryStats returns the current stats of the drivers in a car category, by customer ID.
+func GetDriversCategoryStats(db *gorm.DB, custIds []int, carCategory string) (map[int]*drivers_models.DriverStats, error) {
+	var stats []*drivers_models.DriverStats
+	err := db.
+		Where("cust_id IN ?", custIds).
+		Where("car_category = ?", carCategory).
+		Find(&stats).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	statsMap := make(map[int]*drivers_models.DriverStats)
+	for _, stat := range stats {
+		statsMap[stat.CustID] = stat
+	}
+
+	return statsMap, nil
+}
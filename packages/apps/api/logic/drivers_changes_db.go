@@ -0,0 +1,63 @@
+package logic
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/drivers_models"
+)
+
+// GetDriverNameChanges returns the name changes of a driver, the latest first.
+func GetDriverNameChanges(db *gorm.DB, custId int) ([]*drivers_models.DriverNameChange, error) {
+	var changes []*drivers_models.DriverNameChange
+	err := db.
+		Where("cust_id = ?", custId).
+		Order("changed_at DESC").
+		Find(&changes).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// GetNameChangesSince returns the name changes since a time, the latest first.
+// The customer IDs are optional.
+func GetNameChangesSince(db *gorm.DB, since time.Time, custIds []int) ([]*drivers_models.DriverNameChange, error) {
+	query := db.Where("changed_at >= ?", since)
+	if len(custIds) > 0 {
+		query = query.Where("cust_id IN ?", custIds)
+	}
+
+	var changes []*drivers_models.DriverNameChange
+	err := query.
+		Order("changed_at DESC, cust_id").
+		Find(&changes).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// GetMissingDriversSince returns the drivers marked as missing since a time, the latest first.
+// The customer IDs are optional.
+func GetMissingDriversSince(db *gorm.DB, since time.Time, custIds []int) ([]*drivers_models.Driver, error) {
+	query := db.Where("missing_since >= ?", since)
+	if len(custIds) > 0 {
+		query = query.Where("cust_id IN ?", custIds)
+	}
+
+	var drivers []*drivers_models.Driver
+	err := query.
+		Order("missing_since DESC, cust_id").
+		Find(&drivers).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return drivers, nil
+}
@@ -0,0 +1,84 @@
+package logic
+
+import (
+	"strconv"
+	"strings"
+
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/drivers_models"
+)
+
+// The minimum trigram similarity of a name to match a search which is not a prefix
+const nameSimilarityThreshold = 0.3
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchDrivers returns the drivers whose name, or a word of it, starts with the query
+// or is similar to it, the prefix matches first, then by similarity.
+// The location is optional.
+func SearchDrivers(db *gorm.DB, query string, location string, limit int) ([]*drivers_models.Driver, error) {
+	query = strings.ToLower(strings.TrimSpace(query))
+	prefix := likeEscaper.Replace(query) + "%"
+	wordPrefix := "% " + prefix
+
+	var drivers []*drivers_models.Driver
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// The % operator can use the trigram index, unlike the similarity function.
+		// Its threshold is set only for the transaction of the search.
+		err := tx.Exec("SELECT set_config('pg_trgm.similarity_threshold', ?, true)", strconv.FormatFloat(nameSimilarityThreshold, 'f', -1, 64)).Error
+		if err != nil {
+			return err
+		}
+
+		dbQuery := tx.
+			Where("lower(name) LIKE ? OR lower(name) LIKE ? OR lower(name) % ?", prefix, wordPrefix, query)
+		if location != "" {
+			dbQuery = dbQuery.Where("location = ?", location)
+		}
+
+		return dbQuery.
+			Order(gorm.Expr("(lower(name) LIKE ? OR lower(name) LIKE ?) DESC, similarity(lower(name), ?) DESC, name, cust_id", prefix, wordPrefix, query)).
+			Limit(limit).
+			Find(&drivers).
+			Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return drivers, nil
+}
+
+func GetDrivers(db *gorm.DB, custIds []int) ([]*drivers_models.Driver, error) {
+	var drivers []*drivers_models.Driver
+	err := db.
+		Where("cust_id IN ?", custIds).
+		Order("cust_id").
+		Find(&drivers).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return drivers, nil
+}
+
+// GetDriversCurrentStats returns the current stats of the drivers in all the car categories, by customer ID.
+func GetDriversCurrentStats(db *gorm.DB, custIds []int) (map[int][]*drivers_models.DriverStats, error) {
+	var stats []*drivers_models.DriverStats
+	err := db.
+		Where("cust_id IN ?", custIds).
+		Order("cust_id, car_category").
+		Find(&stats).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	statsMap := make(map[int][]*drivers_models.DriverStats)
+	for _, stat := range stats {
+		statsMap[stat.CustID] = append(statsMap[stat.CustID], stat)
+	}
+
+	return statsMap, nil
+}
@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/api/ranking"
 	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
 )
 
@@ -24,7 +25,8 @@ func GetCompetitionSessions(db *gorm.DB, competitionId uint) ([]*CompetitionSess
 		Joins("join event_groups on sessions.track_id = event_groups.i_racing_track_id and text(date(sessions.launch_at)) = ANY(event_groups.dates)").
 		Joins("join competitions on competitions.id = event_groups.competition_id").
 		Where("event_groups.competition_id = ?", competitionId).
-		Where("session_simsessions.simsession_name = ?", "QUALIFY").
+		// The race in position mode, otherwise the qualifying
+		Where("session_simsessions.simsession_name = CASE WHEN COALESCE(NULLIF(event_groups.qualifying_mode, ''), competitions.qualifying_mode) = ? THEN 'RACE' ELSE 'QUALIFY' END", ranking.ModePosition).
 		Where("sessions.league_id = competitions.league_id").
 		Where("sessions.season_id = competitions.season_id").
 		Order("event_groups.id, sessions.launch_at").
@@ -113,6 +115,20 @@ func GetLaps(db *gorm.DB, simsessionIds [][]int) ([]*events_models.Lap, error) {
 	return laps, nil
 }
 
+func GetSimsessionsParticipants(db *gorm.DB, simsessionIds [][]int) ([]*events_models.SessionSimsessionParticipant, error) {
+	var participants []*events_models.SessionSimsessionParticipant
+	err := db.
+		Where("(subsession_id, simsession_number) IN ?", simsessionIds).
+		Order("subsession_id, simsession_number, cust_id").
+		Find(&participants).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return participants, nil
+}
+
 func GetEventGroups(db *gorm.DB, competitionId uint) ([]*events_models.EventGroup, error) {
 	var groups []*events_models.EventGroup
 	err := db.
@@ -165,3 +181,98 @@ func GetSessionParticipants(db *gorm.DB, subsessionId int, simsessionNumber int)
 
 	return participants, nil
 }
+
+func GetSeasonSessions(db *gorm.DB, leagueId int, seasonId int) ([]*events_models.LeagueSeasonSession, error) {
+	var sessions []*events_models.LeagueSeasonSession
+	err := db.
+		Where("league_id = ?", leagueId).
+		Where("season_id = ?", seasonId).
+		Order("launch_at, session_id").
+		Find(&sessions).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func GetLeague(db *gorm.DB, leagueId int) (*events_models.League, error) {
+	var league events_models.League
+	err := db.
+		Where("league_id = ?", leagueId).
+		First(&league).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &league, nil
+}
+
+func GetLeagueSeasons(db *gorm.DB, leagueId int) ([]*events_models.LeagueSeason, error) {
+	var seasons []*events_models.LeagueSeason
+	err := db.
+		Where("league_id = ?", leagueId).
+		Where("hidden = ?", false).
+		Order("season_id DESC").
+		Find(&seasons).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return seasons, nil
+}
+
+func GetLeagueSeason(db *gorm.DB, leagueId int, seasonId int) (*events_models.LeagueSeason, error) {
+	var season events_models.LeagueSeason
+	err := db.
+		Where("league_id = ?", leagueId).
+		Where("season_id = ?", seasonId).
+		First(&season).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &season, nil
+}
+
+// GetSeasonIngestedSessions returns the subsessions of a season, including the ones
+// not parsed yet, which are associated to the season only by its schedule.
+func GetSeasonIngestedSessions(db *gorm.DB, leagueId int, seasonId int) ([]*events_models.Session, error) {
+	var sessions []*events_models.Session
+	err := db.
+		Where("(league_id = ? AND season_id = ?) OR subsession_id IN (?)",
+			leagueId,
+			seasonId,
+			db.
+				Model(&events_models.LeagueSeasonSession{}).
+				Select("subsession_id").
+				Where("league_id = ?", leagueId).
+				Where("season_id = ?", seasonId).
+				Where("subsession_id <> 0"),
+		).
+		Order("subsession_id").
+		Find(&sessions).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func GetSession(db *gorm.DB, subsessionId int) (*events_models.Session, error) {
+	var session events_models.Session
+	err := db.
+		Where("subsession_id = ?", subsessionId).
+		First(&session).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
@@ -2,13 +2,17 @@ package logic
 
 import (
 	"fmt"
+	"strconv"
 	"time"
 
+	"riccardotornesello.it/sharedtelemetry/iracing/api/ranking"
 	"riccardotornesello.it/sharedtelemetry/iracing/api/utils"
 	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
 )
 
-func GenerateSessionsCsv(sessions []*CompetitionSession, drivers []*events_models.CompetitionDriver, allResults map[int]map[int]int) string {
+// GenerateSessionsCsv returns the results of the drivers in each session: the times,
+// or the positions for the event groups in position mode.
+func GenerateSessionsCsv(sessions []*CompetitionSession, drivers []*events_models.CompetitionDriver, allResults map[int]map[int]int, eventGroupRules map[uint]ranking.Rules) string {
 	// Generate CSV the header
 	loc, _ := time.LoadLocation("Europe/Rome")
 	csv := "Driver,Id,"
@@ -21,12 +25,16 @@ func GenerateSessionsCsv(sessions []*CompetitionSession, drivers []*events_model
 	for _, driver := range drivers {
 		csv += fmt.Sprintf("%s %s,%d,", driver.FirstName, driver.LastName, driver.IRacingCustId)
 		for _, session := range sessions {
-			timeString := ""
-			lapTime, ok := allResults[driver.IRacingCustId][session.SubsessionId]
+			resultString := ""
+			result, ok := allResults[driver.IRacingCustId][session.SubsessionId]
 			if ok {
-				timeString = utils.FormatTime(lapTime)
+				if eventGroupRules[session.EventGroupId].Mode == ranking.ModePosition {
+					resultString = strconv.Itoa(result)
+				} else {
+					resultString = utils.FormatTime(result)
+				}
 			}
-			csv += fmt.Sprintf("%s,", timeString)
+			csv += fmt.Sprintf("%s,", resultString)
 		}
 		csv += "\n"
 	}
@@ -0,0 +1,89 @@
+package ranking
+
+import "sort"
+
+// The event of the laps with a pit stop, which always end or restart a stint.
+// It can't be allowed by the rules.
+const PittedEvent = "pitted"
+
+// The events which invalidate a lap, if not specified by the rules
+var DefaultDisallowedEvents = []string{
+	"black flag",
+	"car contact",
+	"car reset",
+	"clock smash",
+	"contact",
+	"discontinuity",
+	"interpolated crossing",
+	"invalid",
+	"lost control",
+	"off track",
+	PittedEvent,
+}
+
+// InvalidatingEvents returns the events which invalidate a lap with the rules, sorted by name.
+func (r *Rules) InvalidatingEvents() []string {
+	checker := newLapChecker(*r)
+
+	events := make([]string, 0, len(checker.disallowedEvents))
+	for event := range checker.disallowedEvents {
+		events = append(events, event)
+	}
+	sort.Strings(events)
+
+	return events
+}
+
+// lapChecker checks the validity of the laps with the rules of the competition
+type lapChecker struct {
+	disallowedEvents map[string]bool
+	allowIncidents   bool
+}
+
+func newLapChecker(rules Rules) *lapChecker {
+	disallowedEvents := rules.DisallowedEvents
+	if len(disallowedEvents) == 0 {
+		disallowedEvents = DefaultDisallowedEvents
+	}
+
+	checker := &lapChecker{
+		disallowedEvents: make(map[string]bool),
+		allowIncidents:   rules.AllowIncidents,
+	}
+	for _, event := range disallowedEvents {
+		checker.disallowedEvents[event] = true
+	}
+	for _, event := range rules.AllowedEvents {
+		delete(checker.disallowedEvents, event)
+	}
+
+	return checker
+}
+
+func (c *lapChecker) isValid(lap *Lap) bool {
+	if lap.LapNumber <= 0 || lap.LapTime <= 0 {
+		return false
+	}
+
+	if lap.Incident && !c.allowIncidents {
+		return false
+	}
+
+	for _, event := range lap.LapEvents {
+		if c.disallowedEvents[event] {
+			return false
+		}
+	}
+
+	return true
+}
+
+func IsLapPitted(lapEvents []string) bool {
+	for _, event := range lapEvents {
+		if event == PittedEvent {
+			return true
+		}
+	}
+
+	return false
+}
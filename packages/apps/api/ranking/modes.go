@@ -0,0 +1,231 @@
+package ranking
+
+import (
+	"sort"
+)
+
+const (
+	// The first consecutive valid laps
+	ModeConsecutive = "consecutive"
+	// The best valid laps of the session, not necessarily consecutive
+	ModeBest = "best"
+	// The single best valid lap of the session
+	ModeBestLap = "best_lap"
+	// The best window of consecutive valid laps anywhere in the session
+	ModeRolling = "rolling"
+	// The best average of the whole stints of the session, with at least the number of laps
+	ModeStints = "stints"
+	// The total time of the first laps of the session, valid or not
+	ModeTotal = "total"
+	// The finishing position in the race
+	ModePosition = "position"
+)
+
+// modeFunc returns the sum of the times of the laps which make the result of a driver in a session
+// and the number of laps to average them.
+type modeFunc func(laps []*Lap, rules Rules, checker *lapChecker) (int, int, bool)
+
+// The position mode doesn't use the laps
+var modes = map[string]modeFunc{
+	ModeConsecutive: consecutiveLapsTime,
+	ModeBest:        bestLapsTime,
+	ModeBestLap:     bestLapTime,
+	ModeRolling:     rollingLapsTime,
+	ModeStints:      stintsTime,
+	ModeTotal:       totalTime,
+	ModePosition:    nil,
+}
+
+// consecutiveLapsTime returns the sum of the times of the first consecutive valid laps of the session.
+// A stint is interrupted by an invalid lap or by a pit stop, while the pitted laps before the first valid one
+// are skipped. If the pit stops restart the stint, the best completed stint is returned.
+func consecutiveLapsTime(laps []*Lap, rules Rules, checker *lapChecker) (int, int, bool) {
+	bestTimeSum := 0
+	found := false
+
+	stintEnd := false
+	stintValidLaps := 0
+	stintTimeSum := 0
+
+	for _, lap := range laps {
+		if rules.SkipOutLap && lap.LapNumber == 0 {
+			continue
+		}
+
+		if IsLapPitted(lap.LapEvents) {
+			if rules.RestartAfterPit {
+				stintEnd = false
+				stintValidLaps = 0
+				stintTimeSum = 0
+			} else if stintValidLaps > 0 {
+				stintEnd = true
+			}
+
+			continue
+		}
+
+		if stintEnd {
+			continue
+		}
+
+		if !checker.isValid(lap) {
+			stintValidLaps = 0
+			stintEnd = true
+			continue
+		}
+
+		stintValidLaps++
+		stintTimeSum += lap.LapTime
+
+		if stintValidLaps == rules.StintLaps {
+			stintEnd = true
+
+			if !found || stintTimeSum < bestTimeSum {
+				bestTimeSum = stintTimeSum
+				found = true
+			}
+		}
+	}
+
+	return bestTimeSum, rules.StintLaps, found
+}
+
+// bestLapsTime returns the sum of the times of the best valid laps of the session, not necessarily consecutive.
+func bestLapsTime(laps []*Lap, rules Rules, checker *lapChecker) (int, int, bool) {
+	lapTimes := validLapTimes(laps, rules, checker)
+	if len(lapTimes) < rules.StintLaps {
+		return 0, 0, false
+	}
+
+	sort.Ints(lapTimes)
+
+	timeSum := 0
+	for _, lapTime := range lapTimes[:rules.StintLaps] {
+		timeSum += lapTime
+	}
+
+	return timeSum, rules.StintLaps, true
+}
+
+// bestLapTime returns the time of the best valid lap of the session.
+func bestLapTime(laps []*Lap, rules Rules, checker *lapChecker) (int, int, bool) {
+	rules.StintLaps = 1
+	return bestLapsTime(laps, rules, checker)
+}
+
+// rollingLapsTime returns the sum of the times of the best window of consecutive valid laps of the session.
+// The windows are interrupted by the invalid and the pitted laps.
+func rollingLapsTime(laps []*Lap, rules Rules, checker *lapChecker) (int, int, bool) {
+	bestTimeSum := 0
+	found := false
+
+	var window []int
+	windowTimeSum := 0
+
+	for _, lap := range laps {
+		if rules.SkipOutLap && lap.LapNumber == 0 {
+			continue
+		}
+
+		if IsLapPitted(lap.LapEvents) || !checker.isValid(lap) {
+			window = window[:0]
+			windowTimeSum = 0
+			continue
+		}
+
+		window = append(window, lap.LapTime)
+		windowTimeSum += lap.LapTime
+		if len(window) > rules.StintLaps {
+			windowTimeSum -= window[0]
+			window = window[1:]
+		}
+
+		if len(window) == rules.StintLaps && (!found || windowTimeSum < bestTimeSum) {
+			bestTimeSum = windowTimeSum
+			found = true
+		}
+	}
+
+	return bestTimeSum, rules.StintLaps, found
+}
+
+// stintsTime returns the sum of the times and the number of laps of the stint with the best average.
+// A stint is made of all the consecutive valid laps between the invalid and the pitted laps, and it's
+// counted only if it has at least the number of laps of the rules.
+func stintsTime(laps []*Lap, rules Rules, checker *lapChecker) (int, int, bool) {
+	bestTimeSum := 0
+	bestLaps := 0
+
+	stintTimeSum := 0
+	stintLaps := 0
+	endStint := func() {
+		// Compare the averages without dividing the sums
+		if stintLaps >= rules.StintLaps && (bestLaps == 0 || stintTimeSum*bestLaps < bestTimeSum*stintLaps) {
+			bestTimeSum = stintTimeSum
+			bestLaps = stintLaps
+		}
+
+		stintTimeSum = 0
+		stintLaps = 0
+	}
+
+	for _, lap := range laps {
+		if rules.SkipOutLap && lap.LapNumber == 0 {
+			continue
+		}
+
+		if IsLapPitted(lap.LapEvents) || !checker.isValid(lap) {
+			endStint()
+			continue
+		}
+
+		stintTimeSum += lap.LapTime
+		stintLaps++
+	}
+	endStint()
+
+	return bestTimeSum, bestLaps, bestLaps > 0
+}
+
+// totalTime returns the total time of the first laps of the session, from lap 1, valid or not.
+// The driver must have completed all of them.
+func totalTime(laps []*Lap, rules Rules, checker *lapChecker) (int, int, bool) {
+	timeSum := 0
+	completedLaps := 0
+
+	for _, lap := range laps {
+		if lap.LapNumber < 1 || lap.LapNumber > rules.StintLaps {
+			continue
+		}
+		if lap.LapTime <= 0 {
+			return 0, 0, false
+		}
+
+		timeSum += lap.LapTime
+		completedLaps++
+	}
+
+	if completedLaps < rules.StintLaps {
+		return 0, 0, false
+	}
+
+	return timeSum, 1, true
+}
+
+// validLapTimes returns the times of the valid laps of the session which are not pitted.
+func validLapTimes(laps []*Lap, rules Rules, checker *lapChecker) []int {
+	var lapTimes []int
+	for _, lap := range laps {
+		if rules.SkipOutLap && lap.LapNumber == 0 {
+			continue
+		}
+
+		if IsLapPitted(lap.LapEvents) || !checker.isValid(lap) {
+			continue
+		}
+
+		lapTimes = append(lapTimes, lap.LapTime)
+	}
+
+	return lapTimes
+}
@@ -0,0 +1,375 @@
+package ranking
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+const (
+	// The number of laps of the time, if not specified by the rules
+	DefaultStintLaps = 3
+)
+
+type Lap struct {
+	CustId       int
+	SubsessionId int
+	CarId        int
+	LapNumber    int
+	LapTime      int // Ten-thousandths of a second
+	LapEvents    []string
+	Incident     bool
+}
+
+// The finishing positions of a session in position mode are missing, as it was downloaded
+// before they were stored. The session must be downloaded again.
+var ErrUnknownPositions = errors.New("unknown finishing positions")
+
+// A participant of a session, used by the position mode
+type Participant struct {
+	CustId         int
+	SubsessionId   int
+	CarId          int
+	FinishPosition *int // Starting from 0, nil if unknown
+}
+
+type Session struct {
+	SubsessionId int
+	EventGroupId uint
+	Date         string
+}
+
+type Driver struct {
+	CustId int
+	CarId  int
+}
+
+// The mode and the number of laps of an event group, which override the ones of the rules if set
+type EventGroup struct {
+	Id        uint
+	Mode      string
+	StintLaps int
+}
+
+// The zero value of each rule is the default behaviour
+type Rules struct {
+	StintLaps        int
+	Mode             string   // One of the modes, ModeConsecutive if empty
+	DisallowedEvents []string // The events which invalidate a lap, DefaultDisallowedEvents if empty
+	AllowedEvents    []string // Removed from the disallowed events
+	AllowIncidents   bool
+	RestartAfterPit  bool // A pit stop starts a new attempt instead of ending the stint, the best attempt is kept
+	SkipOutLap       bool // Lap 0 is ignored instead of ending the stint
+	Resolution       int  // Resolution of the times in milliseconds, 1 if 0
+	RoundTimes       bool // Round the times to the resolution instead of truncating them
+}
+
+// Validate checks the rules and sets the defaults.
+func (r *Rules) Validate() error {
+	if r.StintLaps == 0 {
+		r.StintLaps = DefaultStintLaps
+	}
+	if r.StintLaps < 0 {
+		return fmt.Errorf("invalid number of laps: %d", r.StintLaps)
+	}
+
+	if r.Mode == "" {
+		r.Mode = ModeConsecutive
+	}
+	if _, ok := modes[r.Mode]; !ok {
+		return fmt.Errorf("invalid mode: %s", r.Mode)
+	}
+
+	if r.Resolution == 0 {
+		r.Resolution = 1
+	}
+	if r.Resolution < 0 {
+		return fmt.Errorf("invalid resolution: %d", r.Resolution)
+	}
+
+	// The pit stops always end or restart a stint, see RestartAfterPit
+	if slices.Contains(r.AllowedEvents, PittedEvent) {
+		return fmt.Errorf("the %s event can't be allowed", PittedEvent)
+	}
+
+	return nil
+}
+
+// ForEventGroup returns the rules with the mode and the number of laps of the event group, if set.
+func (r Rules) ForEventGroup(eventGroup *EventGroup) (Rules, error) {
+	if eventGroup.Mode != "" {
+		r.Mode = eventGroup.Mode
+	}
+	if eventGroup.StintLaps != 0 {
+		r.StintLaps = eventGroup.StintLaps
+	}
+
+	if err := r.Validate(); err != nil {
+		return r, fmt.Errorf("event group %d: %w", eventGroup.Id, err)
+	}
+
+	return r, nil
+}
+
+// averageTime returns the average of the sum of the laps times, in milliseconds with the resolution of the rules.
+func (r *Rules) averageTime(timeSum int, laps int) int {
+	// The lap times are in ten-thousandths of a second
+	divisor := laps * 10 * r.Resolution
+	if r.RoundTimes {
+		return (timeSum + divisor/2) / divisor * r.Resolution
+	}
+
+	return timeSum / divisor * r.Resolution
+}
+
+type Rank struct {
+	Pos     int                     `json:"pos"`
+	CustId  int                     `json:"custId"`
+	Sum     int                     `json:"sum"`
+	IsValid bool                    `json:"isValid"`
+	Results map[uint]map[string]int `json:"results"`
+}
+
+type Result struct {
+	// Result of each driver in each subsession, by customer ID and subsession ID: a time in milliseconds
+	// or a position, depending on the mode. It's 0 if the driver took part in the subsession without a result.
+	SessionResults map[int]map[int]int
+
+	// Best result of each driver, by customer ID, event group and date
+	BestResults map[int]map[uint]map[string]int
+
+	// The drivers sorted by the sum of their best result in each event group. The drivers without
+	// a result in every event group are not valid and are sorted after the valid ones, with a sum of 0.
+	Ranking []*Rank
+
+	// The rules of the competition and of each event group, with the defaults
+	Rules           Rules
+	EventGroupRules map[uint]Rules
+}
+
+// Compute finds the result of each driver in each session with the rules of its event group and ranks the drivers.
+// The laps must be sorted by customer ID, subsession and lap number. Only the laps and the participations
+// with the car of the driver's crew are counted. The lower results are the better ones in every mode.
+func Compute(laps []*Lap, participants []*Participant, sessions []*Session, drivers []*Driver, eventGroups []*EventGroup, rules Rules) (*Result, error) {
+	if err := rules.Validate(); err != nil {
+		return nil, err
+	}
+	checker := newLapChecker(rules)
+
+	eventGroupRules := make(map[uint]Rules)
+	eventGroupIds := make([]uint, len(eventGroups))
+	positionGroups := 0
+	for i, eventGroup := range eventGroups {
+		groupRules, err := rules.ForEventGroup(eventGroup)
+		if err != nil {
+			return nil, err
+		}
+
+		eventGroupRules[eventGroup.Id] = groupRules
+		eventGroupIds[i] = eventGroup.Id
+
+		if groupRules.Mode == ModePosition {
+			positionGroups++
+		}
+	}
+
+	// The positions and the times can't be summed in the ranking
+	if positionGroups > 0 && positionGroups < len(eventGroups) {
+		return nil, fmt.Errorf("the %s mode can't be mixed with the time modes in the event groups", ModePosition)
+	}
+
+	sessionsMap := make(map[int]*Session)
+	sessionRules := make(map[int]Rules)
+	for _, session := range sessions {
+		sessionsMap[session.SubsessionId] = session
+
+		if groupRules, ok := eventGroupRules[session.EventGroupId]; ok {
+			sessionRules[session.SubsessionId] = groupRules
+		}
+	}
+	getSessionRules := func(subsessionId int) Rules {
+		if groupRules, ok := sessionRules[subsessionId]; ok {
+			return groupRules
+		}
+		return rules
+	}
+
+	driverCars := make(map[int]int)
+	for _, driver := range drivers {
+		driverCars[driver.CustId] = driver.CarId
+	}
+
+	result := &Result{
+		SessionResults:  make(map[int]map[int]int),
+		BestResults:     make(map[int]map[uint]map[string]int),
+		Rules:           rules,
+		EventGroupRules: eventGroupRules,
+	}
+
+	// Analyze the laps of each driver in each session
+	for start := 0; start < len(laps); {
+		custId := laps[start].CustId
+		subsessionId := laps[start].SubsessionId
+
+		end := start
+		for end < len(laps) && laps[end].CustId == custId && laps[end].SubsessionId == subsessionId {
+			end++
+		}
+		sessionLaps := laps[start:end]
+		start = end
+
+		result.initSessionResult(custId, subsessionId)
+
+		sessionRules := getSessionRules(subsessionId)
+		if sessionRules.Mode == ModePosition {
+			continue
+		}
+
+		driverCar, ok := driverCars[custId]
+		if !ok {
+			continue
+		}
+
+		driverLaps := make([]*Lap, 0, len(sessionLaps))
+		for _, lap := range sessionLaps {
+			if lap.CarId == driverCar {
+				driverLaps = append(driverLaps, lap)
+			}
+		}
+
+		timeSum, lapsCount, ok := modes[sessionRules.Mode](driverLaps, sessionRules, checker)
+		if !ok {
+			continue
+		}
+
+		result.addSessionResult(custId, sessionsMap[subsessionId], subsessionId, sessionRules.averageTime(timeSum, lapsCount))
+	}
+
+	// Add the positions of the sessions in position mode
+	for _, participant := range participants {
+		if getSessionRules(participant.SubsessionId).Mode != ModePosition {
+			continue
+		}
+
+		// Without the positions the ranking would be silently incomplete
+		if participant.FinishPosition == nil {
+			return nil, fmt.Errorf("subsession %d: %w", participant.SubsessionId, ErrUnknownPositions)
+		}
+
+		result.initSessionResult(participant.CustId, participant.SubsessionId)
+
+		driverCar, ok := driverCars[participant.CustId]
+		if !ok || driverCar != participant.CarId {
+			continue
+		}
+
+		result.addSessionResult(participant.CustId, sessionsMap[participant.SubsessionId], participant.SubsessionId, *participant.FinishPosition+1)
+	}
+
+	result.Ranking = rankDrivers(drivers, eventGroupIds, result.BestResults)
+
+	return result, nil
+}
+
+// initSessionResult sets the result of the driver in the session to 0, if not set yet.
+func (r *Result) initSessionResult(custId int, subsessionId int) {
+	if _, ok := r.SessionResults[custId]; !ok {
+		r.SessionResults[custId] = make(map[int]int)
+	}
+	if _, ok := r.SessionResults[custId][subsessionId]; !ok {
+		r.SessionResults[custId][subsessionId] = 0
+	}
+}
+
+// addSessionResult stores the result of the driver in the session and in the session's event group and date.
+func (r *Result) addSessionResult(custId int, session *Session, subsessionId int, value int) {
+	r.SessionResults[custId][subsessionId] = value
+
+	if session != nil {
+		r.addBestResult(custId, session.EventGroupId, session.Date, value)
+	}
+}
+
+// addBestResult stores the result of the driver for the date in the event group,
+// if it's the first one or if it's better than the previous one.
+func (r *Result) addBestResult(custId int, eventGroupId uint, date string, value int) {
+	if _, ok := r.BestResults[custId]; !ok {
+		r.BestResults[custId] = make(map[uint]map[string]int)
+	}
+	if _, ok := r.BestResults[custId][eventGroupId]; !ok {
+		r.BestResults[custId][eventGroupId] = make(map[string]int)
+	}
+
+	if oldResult, ok := r.BestResults[custId][eventGroupId][date]; !ok || oldResult > value {
+		r.BestResults[custId][eventGroupId][date] = value
+	}
+}
+
+func rankDrivers(drivers []*Driver, eventGroupIds []uint, bestResults map[int]map[uint]map[string]int) []*Rank {
+	ranking := make([]*Rank, 0, len(drivers))
+	for _, driver := range drivers {
+		driverRank := &Rank{
+			CustId:  driver.CustId,
+			Sum:     0,
+			IsValid: true,
+			Results: bestResults[driver.CustId], // TODO: add default value, it might be null
+		}
+
+		driverBestResults, ok := bestResults[driver.CustId]
+		if ok {
+			for _, eventGroupId := range eventGroupIds {
+				driverBestGroupResults, ok := driverBestResults[eventGroupId]
+				if !ok {
+					// The driver did not participate in the event group
+					driverRank.IsValid = false
+					continue
+				}
+
+				// Add the best result of the dates of the event group
+				bestResult := 0
+				for _, result := range driverBestGroupResults {
+					if bestResult == 0 || result < bestResult {
+						bestResult = result
+					}
+				}
+
+				if bestResult > 0 {
+					driverRank.Sum += bestResult
+				} else {
+					driverRank.IsValid = false
+				}
+			}
+		}
+
+		if driverRank.Sum == 0 {
+			driverRank.IsValid = false
+		}
+
+		ranking = append(ranking, driverRank)
+	}
+
+	// Sort the ranking by sum. First the valid ones, then the invalid ones and the ones with 0 sum
+	sort.SliceStable(ranking, func(i, j int) bool {
+		if ranking[i].IsValid != ranking[j].IsValid {
+			return ranking[i].IsValid
+		}
+		if ranking[i].Sum == 0 {
+			return false
+		}
+		if ranking[j].Sum == 0 {
+			return true
+		}
+		return ranking[i].Sum < ranking[j].Sum
+	})
+
+	for i, driver := range ranking {
+		driver.Pos = i + 1
+
+		if !driver.IsValid {
+			driver.Sum = 0
+		}
+	}
+
+	return ranking
+}
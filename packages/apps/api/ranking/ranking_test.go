@@ -0,0 +1,512 @@
+package ranking
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func validLaps(custId int, subsessionId int, carId int, lapTimes ...int) []*Lap {
+	laps := make([]*Lap, len(lapTimes))
+	for i, lapTime := range lapTimes {
+		laps[i] = &Lap{CustId: custId, SubsessionId: subsessionId, CarId: carId, LapNumber: i + 1, LapTime: lapTime}
+	}
+
+	return laps
+}
+
+func concat(lapGroups ...[]*Lap) []*Lap {
+	var laps []*Lap
+	for _, group := range lapGroups {
+		laps = append(laps, group...)
+	}
+
+	return laps
+}
+
+func TestComputeSessionResults(t *testing.T) {
+	sessions := []*Session{{SubsessionId: 100, EventGroupId: 1, Date: "2024-01-01"}}
+	drivers := []*Driver{{CustId: 1, CarId: 10}}
+
+	tests := []struct {
+		name  string
+		laps  []*Lap
+		rules Rules
+		want  map[int]map[int]int
+	}{
+		{
+			name: "first three valid laps",
+			laps: validLaps(1, 100, 10, 900000, 910000, 920000, 800000),
+			want: map[int]map[int]int{1: {100: 91000}},
+		},
+		{
+			name:  "stint length from the rules",
+			laps:  validLaps(1, 100, 10, 900000, 910000, 920000, 800000),
+			rules: Rules{StintLaps: 2},
+			want:  map[int]map[int]int{1: {100: 90500}},
+		},
+		{
+			name: "out lap ends the stint",
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 0, LapTime: 1200000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 900000},
+			},
+			want: map[int]map[int]int{1: {100: 0}},
+		},
+		{
+			name: "pitted lap before the stint is skipped",
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 1200000, LapEvents: []string{"pitted"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 4, LapTime: 900000},
+			},
+			want: map[int]map[int]int{1: {100: 90000}},
+		},
+		{
+			name: "pitted lap ends the stint",
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 1200000, LapEvents: []string{"pitted"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 4, LapTime: 900000},
+			},
+			want: map[int]map[int]int{1: {100: 0}},
+		},
+		{
+			name: "invalid lap ends the stint",
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 900000, LapEvents: []string{"off track"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 4, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 5, LapTime: 900000},
+			},
+			want: map[int]map[int]int{1: {100: 0}},
+		},
+		{
+			name: "incident ends the stint",
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 900000, Incident: true},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 4, LapTime: 900000},
+			},
+			want: map[int]map[int]int{1: {100: 0}},
+		},
+		{
+			name: "laps with another car are ignored",
+			laps: concat(
+				validLaps(1, 100, 20, 800000, 800000, 800000),
+				validLaps(1, 100, 10, 900000, 900000, 900000),
+			),
+			want: map[int]map[int]int{1: {100: 90000}},
+		},
+		{
+			name: "drivers not in the competition are not ranked",
+			laps: validLaps(2, 100, 10, 900000, 900000, 900000),
+			want: map[int]map[int]int{2: {100: 0}},
+		},
+		{
+			name:  "out lap skipped by the rules",
+			rules: Rules{SkipOutLap: true},
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 0, LapTime: 1200000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 900000},
+			},
+			want: map[int]map[int]int{1: {100: 90000}},
+		},
+		{
+			name:  "pit stop restarts the stint, the best one is kept",
+			rules: Rules{RestartAfterPit: true},
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 900000, LapEvents: []string{"off track"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 1200000, LapEvents: []string{"pitted"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 4, LapTime: 920000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 5, LapTime: 920000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 6, LapTime: 920000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 7, LapTime: 1200000, LapEvents: []string{"pitted"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 8, LapTime: 910000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 9, LapTime: 910000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 10, LapTime: 910000},
+			},
+			want: map[int]map[int]int{1: {100: 91000}},
+		},
+		{
+			name:  "best laps not consecutive",
+			rules: Rules{Mode: ModeBest, StintLaps: 2},
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 850000, LapEvents: []string{"off track"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 1200000, LapEvents: []string{"pitted"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 4, LapTime: 920000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 5, LapTime: 880000},
+			},
+			want: map[int]map[int]int{1: {100: 89000}},
+		},
+		{
+			name:  "not enough best laps",
+			rules: Rules{Mode: ModeBest},
+			laps:  validLaps(1, 100, 10, 900000, 900000),
+			want:  map[int]map[int]int{1: {100: 0}},
+		},
+		{
+			name:  "allowed event",
+			rules: Rules{AllowedEvents: []string{"off track"}},
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 900000, LapEvents: []string{"off track"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 900000},
+			},
+			want: map[int]map[int]int{1: {100: 90000}},
+		},
+		{
+			name:  "disallowed events replace the default ones",
+			rules: Rules{DisallowedEvents: []string{"black flag"}},
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 900000, LapEvents: []string{"off track"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 900000, LapEvents: []string{"black flag"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 900000},
+			},
+			want: map[int]map[int]int{1: {100: 0}},
+		},
+		{
+			name:  "incidents allowed",
+			rules: Rules{AllowIncidents: true},
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 900000, Incident: true},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 900000},
+			},
+			want: map[int]map[int]int{1: {100: 90000}},
+		},
+		{
+			name: "times truncated to the millisecond",
+			laps: validLaps(1, 100, 10, 901239, 901239, 901239),
+			want: map[int]map[int]int{1: {100: 90123}},
+		},
+		{
+			name:  "times rounded to the tenth",
+			rules: Rules{Resolution: 100, RoundTimes: true},
+			laps:  validLaps(1, 100, 10, 901500, 901500, 901500),
+			want:  map[int]map[int]int{1: {100: 90200}},
+		},
+		{
+			name:  "times truncated to the tenth",
+			rules: Rules{Resolution: 100},
+			laps:  validLaps(1, 100, 10, 901500, 901500, 901500),
+			want:  map[int]map[int]int{1: {100: 90100}},
+		},
+		{
+			name:  "best lap",
+			rules: Rules{Mode: ModeBestLap},
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 850000, LapEvents: []string{"off track"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 880000},
+			},
+			want: map[int]map[int]int{1: {100: 88000}},
+		},
+		{
+			name:  "best rolling window",
+			rules: Rules{Mode: ModeRolling, StintLaps: 2},
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 870000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 860000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 4, LapTime: 800000, LapEvents: []string{"off track"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 5, LapTime: 850000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 6, LapTime: 1200000, LapEvents: []string{"pitted"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 7, LapTime: 850000},
+			},
+			want: map[int]map[int]int{1: {100: 86500}},
+		},
+		{
+			name:  "best stint average",
+			rules: Rules{Mode: ModeStints, StintLaps: 2},
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 880000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 860000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 4, LapTime: 1200000, LapEvents: []string{"pitted"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 5, LapTime: 800000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 6, LapTime: 800000, LapEvents: []string{"off track"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 7, LapTime: 875000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 8, LapTime: 875000},
+			},
+			want: map[int]map[int]int{1: {100: 87500}},
+		},
+		{
+			name:  "total time",
+			rules: Rules{Mode: ModeTotal, StintLaps: 3},
+			laps: []*Lap{
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 0, LapTime: 1200000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 1, LapTime: 900000},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 2, LapTime: 950000, LapEvents: []string{"off track"}},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 3, LapTime: 910000, Incident: true},
+				{CustId: 1, SubsessionId: 100, CarId: 10, LapNumber: 4, LapTime: 800000},
+			},
+			want: map[int]map[int]int{1: {100: 276000}},
+		},
+		{
+			name:  "total time of uncompleted laps",
+			rules: Rules{Mode: ModeTotal, StintLaps: 3},
+			laps:  validLaps(1, 100, 10, 900000, 900000),
+			want:  map[int]map[int]int{1: {100: 0}},
+		},
+		{
+			name: "each session has its own stint",
+			laps: concat(
+				validLaps(1, 100, 10, 900000, 900000, 900000),
+				validLaps(1, 200, 10, 950000, 950000, 950000),
+			),
+			want: map[int]map[int]int{1: {100: 90000, 200: 95000}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Compute(tt.laps, nil, sessions, drivers, []*EventGroup{{Id: 1}}, tt.rules)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(result.SessionResults, tt.want) {
+				t.Errorf("got %v, expected %v", result.SessionResults, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputeRanking(t *testing.T) {
+	sessions := []*Session{
+		{SubsessionId: 100, EventGroupId: 1, Date: "2024-01-01"},
+		{SubsessionId: 101, EventGroupId: 1, Date: "2024-01-02"},
+		{SubsessionId: 102, EventGroupId: 1, Date: "2024-01-01"},
+		{SubsessionId: 200, EventGroupId: 2, Date: "2024-02-01"},
+	}
+	drivers := []*Driver{
+		{CustId: 1, CarId: 10},
+		{CustId: 2, CarId: 10},
+		{CustId: 3, CarId: 10},
+		{CustId: 4, CarId: 10},
+	}
+
+	tests := []struct {
+		name string
+		laps []*Lap
+		want []Rank
+	}{
+		{
+			name: "no laps",
+			want: []Rank{
+				{Pos: 1, CustId: 1},
+				{Pos: 2, CustId: 2},
+				{Pos: 3, CustId: 3},
+				{Pos: 4, CustId: 4},
+			},
+		},
+		{
+			name: "valid drivers by sum of the best results of the event groups",
+			laps: concat(
+				validLaps(1, 100, 10, 900000, 900000, 900000),
+				validLaps(1, 101, 10, 890000, 890000, 890000),
+				validLaps(1, 200, 10, 1000000, 1000000, 1000000),
+				validLaps(2, 100, 10, 880000, 880000, 880000),
+				validLaps(2, 200, 10, 1000000, 1000000, 1000000),
+				validLaps(3, 100, 10, 850000, 850000, 850000),
+			),
+			want: []Rank{
+				{Pos: 1, CustId: 2, Sum: 188000, IsValid: true, Results: map[uint]map[string]int{1: {"2024-01-01": 88000}, 2: {"2024-02-01": 100000}}},
+				{Pos: 2, CustId: 1, Sum: 189000, IsValid: true, Results: map[uint]map[string]int{1: {"2024-01-01": 90000, "2024-01-02": 89000}, 2: {"2024-02-01": 100000}}},
+				{Pos: 3, CustId: 3, Results: map[uint]map[string]int{1: {"2024-01-01": 85000}}},
+				{Pos: 4, CustId: 4},
+			},
+		},
+		{
+			name: "best result of the subsessions of the same date",
+			laps: concat(
+				validLaps(1, 100, 10, 900000, 900000, 900000),
+				validLaps(1, 102, 10, 880000, 880000, 880000),
+				validLaps(1, 200, 10, 1000000, 1000000, 1000000),
+				validLaps(4, 100, 10, 950000, 950000, 950000),
+				validLaps(4, 102, 10, 970000, 970000, 970000),
+				validLaps(4, 200, 10, 990000, 990000, 990000),
+			),
+			want: []Rank{
+				{Pos: 1, CustId: 1, Sum: 188000, IsValid: true, Results: map[uint]map[string]int{1: {"2024-01-01": 88000}, 2: {"2024-02-01": 100000}}},
+				{Pos: 2, CustId: 4, Sum: 194000, IsValid: true, Results: map[uint]map[string]int{1: {"2024-01-01": 95000}, 2: {"2024-02-01": 99000}}},
+				{Pos: 3, CustId: 2},
+				{Pos: 4, CustId: 3},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Compute(tt.laps, nil, sessions, drivers, []*EventGroup{{Id: 1}, {Id: 2}}, Rules{})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(result.Ranking) != len(tt.want) {
+				t.Fatalf("got %d ranks, expected %d", len(result.Ranking), len(tt.want))
+			}
+			for i, rank := range result.Ranking {
+				if !reflect.DeepEqual(*rank, tt.want[i]) {
+					t.Errorf("rank %d: got %+v, expected %+v", i, *rank, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRulesValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   Rules
+		want    Rules
+		wantErr bool
+	}{
+		{
+			name:  "defaults",
+			rules: Rules{},
+			want:  Rules{StintLaps: DefaultStintLaps, Mode: ModeConsecutive, Resolution: 1},
+		},
+		{
+			name:  "custom",
+			rules: Rules{StintLaps: 5, Mode: ModeBest, Resolution: 10},
+			want:  Rules{StintLaps: 5, Mode: ModeBest, Resolution: 10},
+		},
+		{name: "invalid mode", rules: Rules{Mode: "fastest"}, wantErr: true},
+		{name: "invalid laps", rules: Rules{StintLaps: -1}, wantErr: true},
+		{name: "invalid resolution", rules: Rules{Resolution: -10}, wantErr: true},
+		{name: "allowed pitted laps", rules: Rules{AllowedEvents: []string{PittedEvent}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.rules.Validate()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", tt.rules)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(tt.rules, tt.want) {
+				t.Errorf("got %+v, expected %+v", tt.rules, tt.want)
+			}
+		})
+	}
+}
+
+func TestComputePositionsAndEventGroupModes(t *testing.T) {
+	sessions := []*Session{
+		{SubsessionId: 100, EventGroupId: 1, Date: "2024-01-01"},
+		{SubsessionId: 200, EventGroupId: 2, Date: "2024-02-01"},
+	}
+	drivers := []*Driver{
+		{CustId: 1, CarId: 10},
+		{CustId: 2, CarId: 10},
+	}
+	position := func(position int) *int {
+		return &position
+	}
+
+	laps := concat(
+		validLaps(1, 100, 10, 900000, 900000, 900000),
+		validLaps(1, 200, 10, 800000, 820000, 820000),
+		validLaps(2, 100, 10, 910000, 910000, 910000),
+		validLaps(2, 200, 10, 810000, 795000, 810000),
+	)
+	participants := []*Participant{
+		{CustId: 1, SubsessionId: 100, CarId: 10, FinishPosition: position(1)},
+		{CustId: 2, SubsessionId: 100, CarId: 10, FinishPosition: position(2)},
+		{CustId: 1, SubsessionId: 200, CarId: 10, FinishPosition: position(0)},
+		{CustId: 2, SubsessionId: 200, CarId: 10, FinishPosition: position(1)},
+		{CustId: 3, SubsessionId: 200, CarId: 10, FinishPosition: position(2)},
+	}
+
+	tests := []struct {
+		name               string
+		eventGroups        []*EventGroup
+		wantSessionResults map[int]map[int]int
+		wantRanking        []Rank
+		wantErr            bool
+	}{
+		{
+			name:        "event group mode",
+			eventGroups: []*EventGroup{{Id: 1}, {Id: 2, Mode: ModeBestLap}},
+			wantSessionResults: map[int]map[int]int{
+				1: {100: 90000, 200: 80000},
+				2: {100: 91000, 200: 79500},
+			},
+			wantRanking: []Rank{
+				{Pos: 1, CustId: 1, Sum: 170000, IsValid: true, Results: map[uint]map[string]int{1: {"2024-01-01": 90000}, 2: {"2024-02-01": 80000}}},
+				{Pos: 2, CustId: 2, Sum: 170500, IsValid: true, Results: map[uint]map[string]int{1: {"2024-01-01": 91000}, 2: {"2024-02-01": 79500}}},
+			},
+		},
+		{
+			name:        "positions",
+			eventGroups: []*EventGroup{{Id: 1, Mode: ModePosition}, {Id: 2, Mode: ModePosition}},
+			wantSessionResults: map[int]map[int]int{
+				1: {100: 2, 200: 1},
+				2: {100: 3, 200: 2},
+				3: {200: 0},
+			},
+			wantRanking: []Rank{
+				{Pos: 1, CustId: 1, Sum: 3, IsValid: true, Results: map[uint]map[string]int{1: {"2024-01-01": 2}, 2: {"2024-02-01": 1}}},
+				{Pos: 2, CustId: 2, Sum: 5, IsValid: true, Results: map[uint]map[string]int{1: {"2024-01-01": 3}, 2: {"2024-02-01": 2}}},
+			},
+		},
+		{name: "positions mixed with times", eventGroups: []*EventGroup{{Id: 1}, {Id: 2, Mode: ModePosition}}, wantErr: true},
+		{name: "invalid event group mode", eventGroups: []*EventGroup{{Id: 1, Mode: "fastest"}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Compute(laps, participants, sessions, drivers, tt.eventGroups, Rules{})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(result.SessionResults, tt.wantSessionResults) {
+				t.Errorf("got %v, expected %v", result.SessionResults, tt.wantSessionResults)
+			}
+
+			if len(result.Ranking) != len(tt.wantRanking) {
+				t.Fatalf("got %d ranks, expected %d", len(result.Ranking), len(tt.wantRanking))
+			}
+			for i, rank := range result.Ranking {
+				if !reflect.DeepEqual(*rank, tt.wantRanking[i]) {
+					t.Errorf("rank %d: got %+v, expected %+v", i, *rank, tt.wantRanking[i])
+				}
+			}
+		})
+	}
+}
+
+func TestComputeUnknownPositions(t *testing.T) {
+	sessions := []*Session{{SubsessionId: 100, EventGroupId: 1, Date: "2024-01-01"}}
+	drivers := []*Driver{{CustId: 1, CarId: 10}}
+	participants := []*Participant{{CustId: 1, SubsessionId: 100, CarId: 10}}
+
+	_, err := Compute(nil, participants, sessions, drivers, []*EventGroup{{Id: 1, Mode: ModePosition}}, Rules{})
+	if !errors.Is(err, ErrUnknownPositions) {
+		t.Fatalf("got error %v, expected %v", err, ErrUnknownPositions)
+	}
+}
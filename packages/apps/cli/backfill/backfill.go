@@ -0,0 +1,167 @@
+package backfill
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
+	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
+	leagues_parser "riccardotornesello.it/sharedtelemetry/iracing/leagues_parser/logic"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+)
+
+// Start sends to the pipeline the seasons of the league, including the retired ones,
+// and the subsessions of the league left unparsed, e.g. by an interrupted backfill.
+// The retired seasons already synced are skipped, as their schedule can't change anymore.
+func Start(leagueId int, irClient *irapi.IRacingApiClient, db *gorm.DB, seasonsPublisher queue.Publisher, sessionsPublisher queue.Publisher, ctx context.Context) error {
+	seasons, err := leagues_parser.DiscoverLeagueSeasons(leagueId, true, irClient, db)
+	if err != nil {
+		return err
+	}
+
+	if err := leagues_parser.SyncLeagueMetadata(leagueId, irClient, db); err != nil {
+		return err
+	}
+
+	seasonsToSync, err := GetSeasonsToSync(leagueId, db)
+	if err != nil {
+		return err
+	}
+
+	sessions, err := GetUnparsedSessions(leagueId, db)
+	if err != nil {
+		return err
+	}
+
+	slog.Info(fmt.Sprintf("League %d: %d seasons found, %d to sync, %d unparsed subsessions to resume", leagueId, len(seasons), len(seasonsToSync), len(sessions)))
+
+	// The unparsed subsessions are sent first, as the season parser sends only the new ones
+	if err := queue.PublishJSON(ctx, sessionsPublisher, sessions...); err != nil {
+		return err
+	}
+
+	return leagues_parser.SendSeasonsToParse(seasonsPublisher, ctx, seasonsToSync)
+}
+
+// GetSeasonsToSync returns the seasons of the league which are active or whose last sync didn't succeed.
+func GetSeasonsToSync(leagueId int, db *gorm.DB) ([]leagues_parser.SeasonInfo, error) {
+	var leagueSeasons []events_models.LeagueSeason
+	err := db.
+		Where("league_id = ?", leagueId).
+		Where("active = ? OR sync_status IS DISTINCT FROM ?", true, events_models.IngestionStatusParsed).
+		Order("season_id").
+		Find(&leagueSeasons).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	seasons := make([]leagues_parser.SeasonInfo, len(leagueSeasons))
+	for i, leagueSeason := range leagueSeasons {
+		seasons[i] = leagues_parser.SeasonInfo{
+			LeagueId: leagueSeason.LeagueID,
+			SeasonId: leagueSeason.SeasonID,
+		}
+	}
+
+	return seasons, nil
+}
+
+// GetUnparsedSessions returns the messages to parse the stored subsessions of the league which are not parsed yet.
+// The subsessions are found in the schedule of the seasons, while the splits and the associated subsessions
+// through the links with the parsed ones, whose launch time they share.
+func GetUnparsedSessions(leagueId int, db *gorm.DB) ([]queue.SessionMessage, error) {
+	var rows []struct {
+		SubsessionID int
+		LaunchAt     time.Time
+	}
+
+	err := db.Raw(`
+		SELECT sessions.subsession_id, MIN(league_season_sessions.launch_at) AS launch_at
+		FROM sessions
+		JOIN league_season_sessions ON league_season_sessions.subsession_id = sessions.subsession_id
+		WHERE league_season_sessions.league_id = ?
+		AND sessions.status <> ?
+		AND sessions.deleted_at IS NULL
+		GROUP BY sessions.subsession_id
+		UNION
+		SELECT sessions.subsession_id, MIN(parents.launch_at) AS launch_at
+		FROM sessions
+		JOIN session_links ON session_links.linked_subsession_id = sessions.subsession_id
+		JOIN sessions AS parents ON parents.subsession_id = session_links.subsession_id
+		WHERE parents.league_id = ?
+		AND sessions.status <> ?
+		AND sessions.deleted_at IS NULL
+		GROUP BY sessions.subsession_id
+		ORDER BY subsession_id
+	`, leagueId, events_models.IngestionStatusParsed, leagueId, events_models.IngestionStatusParsed).Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// A subsession found both in the schedule and through a link is sent once
+	messages := make([]queue.SessionMessage, 0, len(rows))
+	sent := make(map[int]bool)
+	for _, row := range rows {
+		if sent[row.SubsessionID] {
+			continue
+		}
+		sent[row.SubsessionID] = true
+
+		messages = append(messages, queue.SessionMessage{
+			SubsessionId: row.SubsessionID,
+			LaunchAt:     row.LaunchAt.Format(time.RFC3339),
+		})
+	}
+
+	return messages, nil
+}
+
+// Report logs the outcome of the backfill of the league: the seasons by sync status
+// and the subsessions by ingestion status.
+func Report(leagueId int, db *gorm.DB) error {
+	var seasons []struct {
+		SyncStatus string
+		Count      int
+	}
+	err := db.
+		Model(&events_models.LeagueSeason{}).
+		Select("COALESCE(sync_status, '') AS sync_status, COUNT(*) AS count").
+		Where("league_id = ?", leagueId).
+		Group("sync_status").
+		Scan(&seasons).
+		Error
+	if err != nil {
+		return err
+	}
+
+	var sessions []struct {
+		Status string
+		Count  int
+	}
+	err = db.
+		Model(&events_models.Session{}).
+		Select("status, COUNT(*) AS count").
+		Where("league_id = ? OR subsession_id IN (?)",
+			leagueId,
+			db.Model(&events_models.LeagueSeasonSession{}).Select("subsession_id").Where("league_id = ?", leagueId),
+		).
+		Group("status").
+		Scan(&sessions).
+		Error
+	if err != nil {
+		return err
+	}
+
+	for _, season := range seasons {
+		slog.Info(fmt.Sprintf("League %d: %d seasons with sync status %q", leagueId, season.Count, season.SyncStatus))
+	}
+	for _, session := range sessions {
+		slog.Info(fmt.Sprintf("League %d: %d subsessions with status %q", leagueId, session.Count, session.Status))
+	}
+
+	return nil
+}
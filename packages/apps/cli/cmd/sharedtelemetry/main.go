@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strconv"
+
+	"github.com/joho/godotenv"
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/cli/backfill"
+	"riccardotornesello.it/sharedtelemetry/iracing/cli/pipeline"
+	"riccardotornesello.it/sharedtelemetry/iracing/gorm_utils/database"
+	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
+	leagues_parser "riccardotornesello.it/sharedtelemetry/iracing/leagues_parser/logic"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+	season_parser "riccardotornesello.it/sharedtelemetry/iracing/season_parser/logic"
+	sessions_downloader "riccardotornesello.it/sharedtelemetry/iracing/sessions_downloader/logic"
+)
+
+const usage = `Usage:
+  sharedtelemetry sync league <leagueId>             import the active seasons of a league
+  sharedtelemetry sync season                        import the active seasons of the leagues in the database
+  sharedtelemetry sync season <leagueId> <seasonId>  import a season
+  sharedtelemetry import subsession <subsessionId>   import a subsession and its linked subsessions
+  sharedtelemetry backfill league <leagueId>         import all the seasons of a league, including the retired ones
+`
+
+func main() {
+	cmd, err := parseCommand(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n\n%s", err, usage)
+		os.Exit(2)
+	}
+
+	// Get configuration
+	godotenv.Load()
+
+	dbUser := os.Getenv("DB_USER")
+	dbPass := os.Getenv("DB_PASS")
+	dbName := os.Getenv("DB_NAME")
+	dbPort := os.Getenv("DB_PORT")
+	dbHost := os.Getenv("DB_HOST")
+
+	iRacingEmail := os.Getenv("IRACING_EMAIL")
+	iRacingPassword := os.Getenv("IRACING_PASSWORD")
+
+	skipAi := os.Getenv("SKIP_AI") != "false"
+	skipNoLaps := os.Getenv("SKIP_NO_LAPS") == "true"
+	skipCustIds, err := sessions_downloader.ParseCustIds(os.Getenv("SKIP_CUST_IDS"))
+	if err != nil {
+		log.Fatalf("sessions_downloader.ParseCustIds: %v", err)
+	}
+
+	sessionWorkers, _ := strconv.Atoi(os.Getenv("SESSION_WORKERS"))
+	if sessionWorkers == 0 {
+		sessionWorkers = 2
+	}
+
+	// Initialize database
+	db, err := database.Connect(dbUser, dbPass, dbHost, dbPort, dbName, 20, 2)
+	if err != nil {
+		log.Fatalf("database.Connect: %v", err)
+	}
+
+	// Initialize iRacing client
+	irClient, err := irapi.NewIRacingApiClient(iRacingEmail, iRacingPassword)
+	if err != nil {
+		log.Fatalf("irapi.NewIRacingApiClient: %v", err)
+	}
+
+	// Run the pipeline until all the jobs are completed or the command is interrupted
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	filter := sessions_downloader.NewParticipantsFilter(skipAi, skipNoLaps, skipCustIds)
+	p := pipeline.New(irClient, db, filter, sessionWorkers)
+
+	err = p.Run(ctx, func(ctx context.Context) error {
+		return cmd.start(ctx, p, irClient, db)
+	})
+	if err != nil {
+		log.Fatalf("pipeline.Run: %v", err)
+	}
+
+	if cmd.report != nil {
+		if err := cmd.report(db); err != nil {
+			log.Fatalf("report: %v", err)
+		}
+	}
+
+	log.Println("Completed")
+}
+
+type startFunc func(ctx context.Context, p *pipeline.Pipeline, irClient *irapi.IRacingApiClient, db *gorm.DB) error
+
+type command struct {
+	start  startFunc               // Sends the first messages of the command to the pipeline
+	report func(db *gorm.DB) error // Optional, called when all the jobs are completed
+}
+
+// parseCommand returns the command to run in the pipeline.
+func parseCommand(args []string) (*command, error) {
+	if len(args) < 2 {
+		return nil, fmt.Errorf("missing command")
+	}
+
+	ids := make([]int, len(args)-2)
+	for i, arg := range args[2:] {
+		id, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ID %q", arg)
+		}
+		ids[i] = id
+	}
+
+	switch args[0] + " " + args[1] {
+	case "sync league":
+		if len(ids) != 1 {
+			return nil, fmt.Errorf("sync league requires the league ID")
+		}
+
+		return &command{start: func(ctx context.Context, p *pipeline.Pipeline, irClient *irapi.IRacingApiClient, db *gorm.DB) error {
+			return leagues_parser.SyncLeague(ids[0], irClient, db, p.Seasons, ctx)
+		}}, nil
+
+	case "sync season":
+		switch len(ids) {
+		case 0:
+			return &command{start: func(ctx context.Context, p *pipeline.Pipeline, irClient *irapi.IRacingApiClient, db *gorm.DB) error {
+				// All the active seasons are synced, ignoring their schedule
+				if err := leagues_parser.DiscoverLeagues(db, irClient); err != nil {
+					return err
+				}
+
+				seasons, err := leagues_parser.GetActiveLeagueSeasonIds(db)
+				if err != nil {
+					return err
+				}
+
+				return leagues_parser.SendSeasonsToParse(p.Seasons, ctx, seasons)
+			}}, nil
+		case 2:
+			return &command{start: func(ctx context.Context, p *pipeline.Pipeline, irClient *irapi.IRacingApiClient, db *gorm.DB) error {
+				return queue.PublishJSON(ctx, p.Seasons, queue.SeasonMessage{LeagueId: ids[0], SeasonId: ids[1]})
+			}}, nil
+		default:
+			return nil, fmt.Errorf("sync season requires no arguments or the league ID and the season ID")
+		}
+
+	case "import subsession":
+		if len(ids) != 1 {
+			return nil, fmt.Errorf("import subsession requires the subsession ID")
+		}
+
+		return &command{start: func(ctx context.Context, p *pipeline.Pipeline, irClient *irapi.IRacingApiClient, db *gorm.DB) error {
+			results, err := irClient.GetResults(ids[0])
+			if err != nil {
+				return err
+			}
+
+			sessions := []season_parser.SessionInfo{{SubsessionId: ids[0], LaunchAt: results.StartTime}}
+			// The subsession is sent also if already stored, e.g. by a previous interrupted import
+			if _, err := season_parser.StoreMissingSessions(sessions, db); err != nil {
+				return err
+			}
+
+			return season_parser.SendSessionsToParse(p.Sessions, ctx, sessions)
+		}}, nil
+
+	case "backfill league":
+		if len(ids) != 1 {
+			return nil, fmt.Errorf("backfill league requires the league ID")
+		}
+
+		return &command{
+			start: func(ctx context.Context, p *pipeline.Pipeline, irClient *irapi.IRacingApiClient, db *gorm.DB) error {
+				return backfill.Start(ids[0], irClient, db, p.Seasons, p.Sessions, ctx)
+			},
+			report: func(db *gorm.DB) error {
+				return backfill.Report(ids[0], db)
+			},
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown command %q", args[0]+" "+args[1])
+	}
+}
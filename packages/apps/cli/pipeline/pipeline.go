@@ -0,0 +1,150 @@
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/cloudrun_utils/jobs"
+	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue/memory"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue/outbox"
+	season_parser "riccardotornesello.it/sharedtelemetry/iracing/season_parser/logic"
+	sessions_downloader "riccardotornesello.it/sharedtelemetry/iracing/sessions_downloader/logic"
+)
+
+const (
+	maxAttempts  = 3
+	lapWorkers   = 10
+	pollInterval = time.Second
+)
+
+// Pipeline runs the season parser and the sessions downloader in the same process,
+// connected by in-memory topics instead of Pub/Sub.
+type Pipeline struct {
+	Seasons  *memory.Topic
+	Sessions *memory.Topic
+
+	relay           *outbox.Relay
+	seasonsHandler  queue.Handler
+	sessionsHandler queue.Handler
+	sessionWorkers  int
+}
+
+// New creates the pipeline. The permanent failures are stored as failed jobs
+// of the corresponding service, like in the Cloud Run deployment.
+func New(irClient *irapi.IRacingApiClient, db *gorm.DB, filter *sessions_downloader.ParticipantsFilter, sessionWorkers int) *Pipeline {
+	seasons := memory.NewTopic(maxAttempts)
+	sessions := memory.NewTopic(maxAttempts)
+
+	if sessionWorkers < 1 {
+		sessionWorkers = 1
+	}
+
+	// The outbox topic is unique for each execution, so that the relay sends to the
+	// in-memory topic only the messages of this execution and not the ones of the services
+	outboxTopic := fmt.Sprintf("%s-cli-%d-%d", queue.SessionsTopic, os.Getpid(), time.Now().UnixNano())
+	relay := outbox.NewRelay(db, outboxTopic, sessions)
+
+	return &Pipeline{
+		Seasons:  seasons,
+		Sessions: sessions,
+
+		relay:           relay,
+		seasonsHandler:  jobs.Handler(db, "season_parser", season_parser.NewMessageHandler(irClient, db, relay)),
+		sessionsHandler: jobs.Handler(db, "sessions_downloader", sessions_downloader.NewMessageHandler(irClient, db, lapWorkers, filter, relay)),
+		sessionWorkers:  sessionWorkers,
+	}
+}
+
+// Run starts the consumers, calls start to publish the first messages
+// and waits until all the messages, including the ones generated by the handlers, are processed.
+func (p *Pipeline) Run(ctx context.Context, start func(ctx context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	consume := func(topic *memory.Topic, handler queue.Handler) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			topic.Consume(ctx, handler)
+		}()
+	}
+
+	consume(p.Seasons, p.seasonsHandler)
+	for i := 0; i < p.sessionWorkers; i++ {
+		consume(p.Sessions, p.sessionsHandler)
+	}
+
+	err := start(ctx)
+	if err == nil {
+		err = p.wait(ctx)
+	}
+
+	cancel()
+	wg.Wait()
+
+	return err
+}
+
+// wait returns when the in-memory topics and the outbox have no pending messages.
+// The outbox messages left by a failed flush of a handler are sent here,
+// and an error is returned if the outbox can't be flushed.
+func (p *Pipeline) wait(ctx context.Context) error {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	lastSeasons, lastSessions := -1, -1
+	flushFailures := 0
+	for {
+		// The seasons are checked first because their handler publishes sessions,
+		// while the sessions handler publishes only other sessions
+		seasons := p.Seasons.Pending()
+		sessions := p.Sessions.Pending()
+		if seasons == 0 && sessions == 0 {
+			// No handler is running, so the outbox can only contain the messages
+			// whose flush failed
+			sent, err := p.relay.Flush(ctx)
+			if err != nil {
+				flushFailures++
+				if flushFailures >= maxAttempts {
+					return fmt.Errorf("outbox %s: %w", p.relay.Topic(), err)
+				}
+				slog.Error(fmt.Sprintf("outbox %s: %v", p.relay.Topic(), err))
+			} else {
+				flushFailures = 0
+			}
+
+			if err == nil && sent == 0 {
+				outboxPending, err := p.relay.Pending(ctx)
+				if err != nil {
+					return fmt.Errorf("outbox %s: %w", p.relay.Topic(), err)
+				}
+				if outboxPending == 0 {
+					return nil
+				}
+			}
+
+			if sent > 0 {
+				continue
+			}
+		}
+
+		if seasons != lastSeasons || sessions != lastSessions {
+			slog.Info(fmt.Sprintf("Pending jobs: %d seasons, %d sessions (completed: %d seasons, %d sessions)", seasons, sessions, p.Seasons.Completed(), p.Sessions.Completed()))
+			lastSeasons, lastSessions = seasons, sessions
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	"riccardotornesello.it/sharedtelemetry/iracing/drivers_downloader/logic"
@@ -10,11 +11,7 @@ import (
 	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
 )
 
-const BATCH_SIZE = 500
-
 func main() {
-	// TODO: prevent deadlock when the job is running
-
 	// Get configuration
 	godotenv.Load()
 
@@ -45,11 +42,23 @@ func main() {
 	}
 	log.Println("iRacing client initialized")
 
-	// Start the job
-	log.Println("Starting job for car class", carClass)
-	err = logic.UpdateDriverStatsByCategory(db, irClient, carClass, BATCH_SIZE)
-	if err != nil {
-		log.Fatal(err)
+	// Start the job, for all the car classes if not specified
+	start := time.Now()
+	if carClass == "" || carClass == "all" {
+		log.Println("Starting job for all the car classes")
+		results, err := logic.UpdateAllDriverStats(db, irClient)
+		for _, result := range results {
+			log.Printf("%s: %d drivers in %v", result.CarClass, result.Drivers, result.Duration)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	} else {
+		log.Println("Starting job for car class", carClass)
+		err = logic.UpdateDriverStatsByCategory(db, irClient, carClass)
+		if err != nil {
+			log.Fatal(err)
+		}
 	}
-	log.Println("Job completed")
+	log.Printf("Job completed in %v", time.Since(start))
 }
@@ -3,6 +3,7 @@ module riccardotornesello.it/sharedtelemetry/iracing/drivers_downloader
 go 1.23.2
 
 require (
+	github.com/jackc/pgx/v5 v5.5.5
 	github.com/joho/godotenv v1.5.1
 	gorm.io/gorm v1.25.12
 	riccardotornesello.it/sharedtelemetry/iracing/drivers_models v0.0.0-00010101000000-000000000000
@@ -25,7 +26,6 @@ require (
 	github.com/golang-sql/sqlexp v0.1.0 // indirect
 	github.com/jackc/pgpassfile v1.0.0 // indirect
 	github.com/jackc/pgservicefile v0.0.0-20231201235250-de7065d80cb9 // indirect
-	github.com/jackc/pgx/v5 v5.5.5 // indirect
 	github.com/jackc/puddle/v2 v2.2.1 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
@@ -0,0 +1,105 @@
+package logic
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
+)
+
+// The car categories with a driver stats CSV
+var CarCategories = []string{"sports_car", "oval", "formula_car", "road", "dirt_oval", "dirt_road"}
+
+type CategoryResult struct {
+	CarClass string
+	Drivers  int64
+	Duration time.Duration
+	Err      error
+}
+
+// UpdateAllDriverStats imports the stats of all the car categories concurrently.
+// The drivers are merged once at the end from the staging tables of the imported categories,
+// without the duplicates of the categories. If all the categories are imported, the drivers
+// not in any of them are marked as missing.
+// A failed category doesn't stop the others: the results of each category are returned
+// together with the joined errors.
+func UpdateAllDriverStats(db *gorm.DB, irClient *irapi.IRacingApiClient) ([]*CategoryResult, error) {
+	now := time.Now()
+
+	results := make([]*CategoryResult, len(CarCategories))
+	var wg sync.WaitGroup
+	for i, carClass := range CarCategories {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			start := time.Now()
+			count, err := updateCategoryStats(db, irClient, carClass, now, false)
+			results[i] = &CategoryResult{
+				CarClass: carClass,
+				Drivers:  count,
+				Duration: time.Since(start),
+				Err:      err,
+			}
+
+			if err != nil {
+				log.Printf("Car class %s failed in %v: %v", carClass, results[i].Duration, err)
+			} else {
+				log.Printf("Car class %s completed: %d drivers in %v", carClass, count, results[i].Duration)
+			}
+		}()
+	}
+	wg.Wait()
+
+	var errs []error
+	importedClasses := make([]string, 0, len(results))
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, fmt.Errorf("car class %s: %w", result.CarClass, result.Err))
+		} else {
+			importedClasses = append(importedClasses, result.CarClass)
+		}
+	}
+
+	// Update the drivers of all the imported categories
+	log.Println("Merging the drivers")
+	if err := mergeAllDrivers(db, importedClasses, len(errs) == 0, now); err != nil {
+		errs = append(errs, fmt.Errorf("drivers: %w", err))
+	}
+
+	return results, errors.Join(errs...)
+}
+
+func mergeAllDrivers(db *gorm.DB, carClasses []string, markMissing bool, now time.Time) error {
+	tx := db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	if err := MergeDrivers(tx, carClasses, now); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if markMissing {
+		missing, err := MarkMissingDrivers(tx, carClasses, now)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+		log.Printf("Drivers marked as missing: %d", missing)
+	}
+
+	if err := truncateStagingTables(tx, carClasses); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit().Error
+}
@@ -4,21 +4,64 @@ import (
 	"encoding/csv"
 	"fmt"
 	"io"
+	"log/slog"
 	"strconv"
+	"strings"
 
 	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
 )
 
+// Columns of the driver stats CSV
+const (
+	columnDriver            = "DRIVER"
+	columnCustId            = "CUSTID"
+	columnLocation          = "LOCATION"
+	columnClubName          = "CLUB_NAME"
+	columnStarts            = "STARTS"
+	columnWins              = "WINS"
+	columnAvgStartPosition  = "AVG_START_POS"
+	columnAvgFinishPosition = "AVG_FINISH_POS"
+	columnAvgPoints         = "AVG_POINTS"
+	columnTop25Percent      = "TOP25PCNT"
+	columnLaps              = "LAPS"
+	columnLapsLed           = "LAPSLEAD"
+	columnAvgIncidents      = "AVG_INC"
+	columnClass             = "CLASS"
+	columnIrating           = "IRATING"
+	columnTTRating          = "TTRATING"
+	columnClubPoints        = "TOT_CLUB_POINTS"
+	columnChampPoints       = "CHAMP_POINTS"
+)
+
+// The columns without which the stats can't be stored. The other ones are left empty if missing.
+var requiredColumns = []string{columnDriver, columnCustId, columnClass, columnIrating}
+
 type DriversCsv struct {
 	csvReader *csv.Reader
+	columns   map[string]int
 }
 
 type DriversCsvRow struct {
-	Driver   string
-	CustId   int
-	Location string
-	Class    string
-	Irating  int
+	Driver            string
+	CustId            int
+	Location          string
+	ClubName          string
+	Starts            int
+	Wins              int
+	AvgStartPosition  float64
+	AvgFinishPosition float64
+	AvgPoints         float64
+	Top25Percent      int
+	Laps              int
+	LapsLed           int
+	AvgIncidents      float64
+	Class             string
+	LicenseClass      string
+	SafetyRating      *float64 // Nil if missing or invalid
+	Irating           int
+	TTRating          int
+	ClubPoints        int
+	ChampPoints       int
 }
 
 func GetDriverStatsByCategory(irClient *irapi.IRacingApiClient, carClass string) (io.ReadCloser, error) {
@@ -45,12 +88,42 @@ func GetDriverStatsByCategory(irClient *irapi.IRacingApiClient, carClass string)
 	return csvContent, err
 }
 
-func CheckCsvReader(header []string) error {
-	if header[0] != "DRIVER" || header[1] != "CUSTID" || header[2] != "LOCATION" || header[13] != "CLASS" || header[14] != "IRATING" {
-		return fmt.Errorf("Invalid header: %v", header)
+// GetCsvColumns returns the index of each column of the header, by name.
+// The names are case insensitive and the order of the columns doesn't matter.
+func GetCsvColumns(header []string) (map[string]int, error) {
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		// The first column may start with the UTF-8 byte order mark
+		name = strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		columns[name] = i
+	}
+
+	for _, name := range requiredColumns {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("Invalid header, missing column %s: %v", name, header)
+		}
 	}
 
-	return nil
+	return columns, nil
+}
+
+// ParseLicense splits a license, like "A 3.45", into the class and the safety rating.
+// The safety rating is nil if missing. If it is invalid, the class is returned with the error.
+func ParseLicense(license string) (string, *float64, error) {
+	fields := strings.Fields(license)
+	if len(fields) == 0 {
+		return "", nil, nil
+	}
+	if len(fields) == 1 {
+		return fields[0], nil, nil
+	}
+
+	safetyRating, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return fields[0], nil, fmt.Errorf("invalid license %q: %w", license, err)
+	}
+
+	return fields[0], &safetyRating, nil
 }
 
 func NewDriversCsv(irClient *irapi.IRacingApiClient, carClass string) (*DriversCsv, error) {
@@ -60,7 +133,11 @@ func NewDriversCsv(irClient *irapi.IRacingApiClient, carClass string) (*DriversC
 		return nil, err
 	}
 
-	csvReader := csv.NewReader(csvContent)
+	return NewDriversCsvReader(csvContent)
+}
+
+func NewDriversCsvReader(content io.Reader) (*DriversCsv, error) {
+	csvReader := csv.NewReader(content)
 
 	// Check the header
 	header, err := csvReader.Read()
@@ -68,13 +145,13 @@ func NewDriversCsv(irClient *irapi.IRacingApiClient, carClass string) (*DriversC
 		return nil, err
 	}
 
-	err = CheckCsvReader(header)
+	columns, err := GetCsvColumns(header)
 	if err != nil {
 		return nil, err
 	}
 
 	// Return the DriversCsv struct
-	return &DriversCsv{csvReader: csvReader}, nil
+	return &DriversCsv{csvReader: csvReader, columns: columns}, nil
 }
 
 func (d *DriversCsv) Read() (*DriversCsvRow, error) {
@@ -83,21 +160,85 @@ func (d *DriversCsv) Read() (*DriversCsvRow, error) {
 		return nil, err
 	}
 
-	custId, err := strconv.Atoi(record[1])
+	r := &csvRecord{record: record, columns: d.columns}
+
+	row := &DriversCsvRow{
+		Driver:            r.string(columnDriver),
+		CustId:            r.int(columnCustId),
+		Location:          r.string(columnLocation),
+		ClubName:          r.string(columnClubName),
+		Starts:            r.int(columnStarts),
+		Wins:              r.int(columnWins),
+		AvgStartPosition:  r.float(columnAvgStartPosition),
+		AvgFinishPosition: r.float(columnAvgFinishPosition),
+		AvgPoints:         r.float(columnAvgPoints),
+		Top25Percent:      r.int(columnTop25Percent),
+		Laps:              r.int(columnLaps),
+		LapsLed:           r.int(columnLapsLed),
+		AvgIncidents:      r.float(columnAvgIncidents),
+		Class:             r.string(columnClass),
+		Irating:           r.int(columnIrating),
+		TTRating:          r.int(columnTTRating),
+		ClubPoints:        r.int(columnClubPoints),
+		ChampPoints:       r.int(columnChampPoints),
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	if row.CustId == 0 {
+		return nil, fmt.Errorf("missing %s in record %v", columnCustId, record)
+	}
+
+	// An invalid safety rating doesn't discard the rest of the stats of the driver
+	row.LicenseClass, row.SafetyRating, err = ParseLicense(row.Class)
 	if err != nil {
-		return nil, err
+		slog.Warn(fmt.Sprintf("Driver %d: %v", row.CustId, err))
+	}
+
+	return row, nil
+}
+
+// csvRecord reads the values of a record by column name.
+// The first parsing error is kept and the following values are ignored.
+type csvRecord struct {
+	record  []string
+	columns map[string]int
+	err     error
+}
+
+func (r *csvRecord) string(column string) string {
+	i, ok := r.columns[column]
+	if !ok || i >= len(r.record) {
+		return ""
 	}
 
-	irating, err := strconv.Atoi(record[14])
+	return strings.TrimSpace(r.record[i])
+}
+
+func (r *csvRecord) int(column string) int {
+	value := r.string(column)
+	if value == "" || r.err != nil {
+		return 0
+	}
+
+	n, err := strconv.Atoi(value)
 	if err != nil {
-		return nil, err
+		r.err = fmt.Errorf("invalid %s %q: %w", column, value, err)
+	}
+
+	return n
+}
+
+func (r *csvRecord) float(column string) float64 {
+	value := r.string(column)
+	if value == "" || r.err != nil {
+		return 0
+	}
+
+	n, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		r.err = fmt.Errorf("invalid %s %q: %w", column, value, err)
 	}
 
-	return &DriversCsvRow{
-		Driver:   record[0],
-		CustId:   custId,
-		Location: record[2],
-		Class:    record[13],
-		Irating:  irating,
-	}, nil
+	return n
 }
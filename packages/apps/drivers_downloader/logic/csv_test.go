@@ -0,0 +1,121 @@
+package logic
+
+import (
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDriversCsv(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []DriversCsvRow
+		wantErr bool
+	}{
+		{
+			name: "all columns",
+			content: "\ufeffDRIVER,CUSTID,LOCATION,CLUB_NAME,STARTS,WINS,AVG_START_POS,AVG_FINISH_POS,AVG_POINTS,TOP25PCNT,LAPS,LAPSLEAD,AVG_INC,CLASS,IRATING,TTRATING,TOT_CLUB_POINTS,CHAMP_POINTS\n" +
+				"Mario Rossi,123,IT,Italy,10,2,3.5,4.25,80,60,250,40,1.75,A 3.45,2500,1400,300,120\n",
+			want: []DriversCsvRow{{
+				Driver:            "Mario Rossi",
+				CustId:            123,
+				Location:          "IT",
+				ClubName:          "Italy",
+				Starts:            10,
+				Wins:              2,
+				AvgStartPosition:  3.5,
+				AvgFinishPosition: 4.25,
+				AvgPoints:         80,
+				Top25Percent:      60,
+				Laps:              250,
+				LapsLed:           40,
+				AvgIncidents:      1.75,
+				Class:             "A 3.45",
+				LicenseClass:      "A",
+				SafetyRating:      ptr(3.45),
+				Irating:           2500,
+				TTRating:          1400,
+				ClubPoints:        300,
+				ChampPoints:       120,
+			}},
+		},
+		{
+			name: "reordered and missing columns",
+			content: "irating,class,custid,driver\n" +
+				"1350,R 2.50,456,Luigi Verdi\n" +
+				"1200,D,789,Anna Bianchi\n",
+			want: []DriversCsvRow{
+				{Driver: "Luigi Verdi", CustId: 456, Class: "R 2.50", LicenseClass: "R", SafetyRating: ptr(2.5), Irating: 1350},
+				{Driver: "Anna Bianchi", CustId: 789, Class: "D", LicenseClass: "D", Irating: 1200},
+			},
+		},
+		{
+			name: "invalid safety rating",
+			content: "DRIVER,CUSTID,CLASS,IRATING\n" +
+				"Mario Rossi,123,A x.yz,2500\n",
+			want: []DriversCsvRow{
+				{Driver: "Mario Rossi", CustId: 123, Class: "A x.yz", LicenseClass: "A", Irating: 2500},
+			},
+		},
+		{
+			name:    "missing required column",
+			content: "DRIVER,CUSTID,CLASS\nMario Rossi,123,A 3.45\n",
+			wantErr: true,
+		},
+		{
+			name:    "invalid value",
+			content: "DRIVER,CUSTID,CLASS,IRATING\nMario Rossi,123,A 3.45,unknown\n",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rows, err := readDriversCsv(tt.content)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %d rows", len(rows))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(rows) != len(tt.want) {
+				t.Fatalf("got %d rows, expected %d", len(rows), len(tt.want))
+			}
+			for i := range rows {
+				if !reflect.DeepEqual(rows[i], tt.want[i]) {
+					t.Errorf("row %d: got %+v, expected %+v", i, rows[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func readDriversCsv(content string) ([]DriversCsvRow, error) {
+	driversCsv, err := NewDriversCsvReader(strings.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []DriversCsvRow
+	for {
+		row, err := driversCsv.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rows = append(rows, *row)
+	}
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
@@ -1,86 +1,338 @@
 package logic
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
 	"io"
 	"log"
+	"strings"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"gorm.io/gorm"
-	"gorm.io/gorm/clause"
-	"riccardotornesello.it/sharedtelemetry/iracing/drivers_models"
 	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
 )
 
-func UpdateDriverStatsByCategory(db *gorm.DB, irClient *irapi.IRacingApiClient, carClass string, batchSize int) error {
-	now := time.Now()
+// Columns of the staging tables, in the order of the values of the copy source
+var stagingColumns = []string{
+	"cust_id",
+	"name",
+	"location",
+	"club_name",
+	"license",
+	"license_class",
+	"safety_rating",
+	"i_rating",
+	"tt_rating",
+	"starts",
+	"wins",
+	"avg_start_position",
+	"avg_finish_position",
+	"avg_points",
+	"top25_percent",
+	"laps",
+	"laps_led",
+	"avg_incidents",
+	"club_points",
+	"champ_points",
+}
+
+// The stats columns updated by the merge, in addition to updated_at
+var statsColumns = stagingColumns[4:]
+
+func UpdateDriverStatsByCategory(db *gorm.DB, irClient *irapi.IRacingApiClient, carClass string) error {
+	_, err := updateCategoryStats(db, irClient, carClass, time.Now(), true)
+	return err
+}
+
+// stagingTable returns the name of the staging table of a car category.
+// Each category has its own table, so that the categories can be imported concurrently.
+func stagingTable(carClass string) string {
+	return "driver_stats_staging_" + carClass
+}
+
+// truncateStagingTables empties the staging tables of the car categories once they are merged,
+// so that they don't keep a copy of the CSVs until the next import.
+func truncateStagingTables(tx *gorm.DB, carClasses []string) error {
+	if len(carClasses) == 0 {
+		return nil
+	}
+
+	tables := make([]string, len(carClasses))
+	for i, carClass := range carClasses {
+		tables[i] = pgx.Identifier{stagingTable(carClass)}.Sanitize()
+	}
+
+	return tx.Exec(fmt.Sprintf("TRUNCATE %s", strings.Join(tables, ", "))).Error
+}
 
+// updateCategoryStats imports the stats CSV of a car category and returns the number of rows.
+// The CSV is streamed with COPY FROM into an unlogged staging table, then the stats, their history
+// and, if mergeDrivers is true, the drivers are merged with set-based statements in a single transaction.
+func updateCategoryStats(db *gorm.DB, irClient *irapi.IRacingApiClient, carClass string, now time.Time, mergeDrivers bool) (int64, error) {
 	// Get the stats CSV
 	log.Println("Fetching drivers stats for car class", carClass)
 	driversCsv, err := NewDriversCsv(irClient, carClass)
 	if err != nil {
-		return err
+		return 0, err
 	}
-	log.Println("Drivers stats fetched")
 
-	// Insert the users in groups of size batchSize
-	isEof := false
+	// Copy the CSV into the empty staging table
+	table := pgx.Identifier{stagingTable(carClass)}.Sanitize()
+	err = db.Exec(fmt.Sprintf(`CREATE UNLOGGED TABLE IF NOT EXISTS %s (
+		cust_id bigint NOT NULL,
+		name text,
+		location text,
+		club_name text,
+		license text NOT NULL,
+		license_class text,
+		safety_rating numeric,
+		i_rating bigint NOT NULL,
+		tt_rating bigint,
+		starts bigint,
+		wins bigint,
+		avg_start_position numeric,
+		avg_finish_position numeric,
+		avg_points numeric,
+		top25_percent bigint,
+		laps bigint,
+		laps_led bigint,
+		avg_incidents numeric,
+		club_points bigint,
+		champ_points bigint
+	)`, table)).Error
+	if err != nil {
+		return 0, err
+	}
 
-	for !isEof {
-		log.Println("Processing batch")
-		drivers := make([]*drivers_models.Driver, batchSize)
-		driverStats := make([]*drivers_models.DriverStats, batchSize)
-		n := 0
+	if err := db.Exec(fmt.Sprintf("TRUNCATE %s", table)).Error; err != nil {
+		return 0, err
+	}
 
-		for {
-			record, err := driversCsv.Read()
-			if err == io.EOF {
-				isEof = true
-				break
-			}
-			if err != nil {
-				return err
-			}
+	copied, err := copyDriversCsv(db, driversCsv, stagingTable(carClass))
+	if err != nil {
+		return 0, err
+	}
+	log.Printf("Drivers stats copied for car class %s: %d rows", carClass, copied)
 
-			drivers[n] = &drivers_models.Driver{
-				Name:     record.Driver,
-				CustID:   record.CustId,
-				Location: record.Location,
-			}
+	// Merge the staging table
+	tx := db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
 
-			driverStats[n] = &drivers_models.DriverStats{
-				CustID:      record.CustId,
-				CarCategory: carClass,
-				License:     record.Class,
-				IRating:     record.Irating,
-				CreatedAt:   now,
-				UpdatedAt:   now,
-			}
+	if err := mergeStatsHistory(tx, carClass, now); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
 
-			n++
+	if err := mergeStats(tx, carClass, now); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
 
-			if n == batchSize {
-				break
-			}
+	// Without merging the drivers, the staging table is emptied once they are merged with the other categories
+	if mergeDrivers {
+		if err := MergeDrivers(tx, []string{carClass}, now); err != nil {
+			tx.Rollback()
+			return 0, err
 		}
 
-		if n > 0 {
-			// Update drivers list
-			if err = db.Clauses(clause.OnConflict{
-				Columns:   []clause.Column{{Name: "cust_id"}},
-				DoUpdates: clause.AssignmentColumns([]string{"name", "location"}),
-			}).Create(drivers[:n]).Error; err != nil {
-				return err
-			}
+		if err := truncateStagingTables(tx, []string{carClass}); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
 
-			// Update stats
-			if err = db.Clauses(clause.OnConflict{
-				Columns:   []clause.Column{{Name: "cust_id"}, {Name: "car_category"}},
-				DoUpdates: clause.AssignmentColumns([]string{"license", "i_rating", "updated_at"}),
-			}).Create(driverStats[:n]).Error; err != nil {
-				return err
-			}
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+
+	return copied, nil
+}
+
+// mergeStatsHistory stores a snapshot of the staged stats which are new or different
+// from the ones in the database. It must be called before merging the stats.
+func mergeStatsHistory(db *gorm.DB, carClass string, now time.Time) error {
+	return db.Exec(fmt.Sprintf(`
+		INSERT INTO driver_stats_histories (cust_id, car_category, recorded_at, license, license_class, safety_rating, i_rating)
+		SELECT DISTINCT ON (staging.cust_id) staging.cust_id, ?::text, ?::timestamptz, staging.license, staging.license_class, staging.safety_rating, staging.i_rating
+		FROM %s AS staging
+		LEFT JOIN driver_stats ON driver_stats.cust_id = staging.cust_id AND driver_stats.car_category = ?::text
+		WHERE driver_stats.cust_id IS NULL
+		OR driver_stats.license IS DISTINCT FROM staging.license
+		OR driver_stats.i_rating IS DISTINCT FROM staging.i_rating
+		ORDER BY staging.cust_id
+		ON CONFLICT DO NOTHING
+	`, pgx.Identifier{stagingTable(carClass)}.Sanitize()), carClass, now, carClass).Error
+}
+
+// mergeStats upserts the staged stats of a car category.
+func mergeStats(db *gorm.DB, carClass string, now time.Time) error {
+	updates := make([]string, len(statsColumns))
+	for i, column := range statsColumns {
+		updates[i] = fmt.Sprintf("%s = EXCLUDED.%s", column, column)
+	}
+
+	return db.Exec(fmt.Sprintf(`
+		INSERT INTO driver_stats (created_at, updated_at, cust_id, car_category, %s)
+		SELECT DISTINCT ON (cust_id) ?::timestamptz, ?::timestamptz, cust_id, ?::text, %s
+		FROM %s
+		ORDER BY cust_id
+		ON CONFLICT (cust_id, car_category) DO UPDATE SET updated_at = EXCLUDED.updated_at, %s
+	`,
+		strings.Join(statsColumns, ", "),
+		strings.Join(statsColumns, ", "),
+		pgx.Identifier{stagingTable(carClass)}.Sanitize(),
+		strings.Join(updates, ", "),
+	), now, now, carClass).Error
+}
+
+// MergeDrivers upserts the drivers of the staging tables of the car categories, once for each customer ID.
+// The drivers whose name, location and club didn't change are not written, unless they were missing.
+// The name changes are stored before updating the drivers.
+func MergeDrivers(db *gorm.DB, carClasses []string, now time.Time) error {
+	if len(carClasses) == 0 {
+		return nil
+	}
+
+	sources := make([]string, len(carClasses))
+	for i, carClass := range carClasses {
+		sources[i] = fmt.Sprintf("SELECT cust_id, name, location, club_name FROM %s", pgx.Identifier{stagingTable(carClass)}.Sanitize())
+	}
+	staging := strings.Join(sources, " UNION ALL ")
+
+	err := db.Exec(fmt.Sprintf(`
+		INSERT INTO driver_name_changes (cust_id, changed_at, previous_name, name)
+		SELECT staging.cust_id, ?::timestamptz, drivers.name, staging.name
+		FROM (SELECT DISTINCT ON (cust_id) cust_id, name FROM (%s) AS sources ORDER BY cust_id) AS staging
+		JOIN drivers ON drivers.cust_id = staging.cust_id
+		WHERE drivers.name IS DISTINCT FROM staging.name
+		ORDER BY staging.cust_id
+		ON CONFLICT DO NOTHING
+	`, staging), now).Error
+	if err != nil {
+		return err
+	}
+
+	return db.Exec(fmt.Sprintf(`
+		INSERT INTO drivers (created_at, updated_at, cust_id, name, location, club_name)
+		SELECT DISTINCT ON (cust_id) ?::timestamptz, ?::timestamptz, cust_id, name, location, club_name
+		FROM (%s) AS staging
+		ORDER BY cust_id
+		ON CONFLICT (cust_id) DO UPDATE SET
+			updated_at = EXCLUDED.updated_at,
+			name = EXCLUDED.name,
+			location = EXCLUDED.location,
+			club_name = EXCLUDED.club_name,
+			missing_since = NULL
+		WHERE (drivers.name, drivers.location, drivers.club_name)
+		IS DISTINCT FROM (EXCLUDED.name, EXCLUDED.location, EXCLUDED.club_name)
+		OR drivers.missing_since IS NOT NULL
+	`, staging), now, now).Error
+}
+
+// MarkMissingDrivers marks as missing the drivers which are not in the staging tables of the car categories.
+// It must be called only when all the car categories have been imported, otherwise the drivers
+// of the categories not imported would be marked too.
+func MarkMissingDrivers(db *gorm.DB, carClasses []string, now time.Time) (int64, error) {
+	conditions := make([]string, len(carClasses))
+	for i, carClass := range carClasses {
+		conditions[i] = fmt.Sprintf("NOT EXISTS (SELECT 1 FROM %s AS staging WHERE staging.cust_id = drivers.cust_id)", pgx.Identifier{stagingTable(carClass)}.Sanitize())
+	}
+
+	result := db.Exec(fmt.Sprintf(`
+		UPDATE drivers SET missing_since = ?::timestamptz
+		WHERE missing_since IS NULL
+		AND deleted_at IS NULL
+		AND %s
+	`, strings.Join(conditions, " AND ")), now)
+
+	return result.RowsAffected, result.Error
+}
+
+// driversCsvCopySource feeds the COPY FROM protocol directly from the CSV,
+// so that the rows are never held in memory all together.
+type driversCsvCopySource struct {
+	driversCsv *DriversCsv
+	current    *DriversCsvRow
+	err        error
+}
+
+func (s *driversCsvCopySource) Next() bool {
+	row, err := s.driversCsv.Read()
+	if err != nil {
+		if err != io.EOF {
+			s.err = err
 		}
+		return false
 	}
 
-	return nil
+	s.current = row
+	return true
+}
+
+func (s *driversCsvCopySource) Values() ([]any, error) {
+	row := s.current
+
+	return []any{
+		row.CustId,
+		row.Driver,
+		row.Location,
+		row.ClubName,
+		row.Class,
+		row.LicenseClass,
+		row.SafetyRating,
+		row.Irating,
+		row.TTRating,
+		row.Starts,
+		row.Wins,
+		row.AvgStartPosition,
+		row.AvgFinishPosition,
+		row.AvgPoints,
+		row.Top25Percent,
+		row.Laps,
+		row.LapsLed,
+		row.AvgIncidents,
+		row.ClubPoints,
+		row.ChampPoints,
+	}, nil
+}
+
+func (s *driversCsvCopySource) Err() error {
+	return s.err
+}
+
+// copyDriversCsv copies the rows of the CSV into the table using COPY FROM.
+func copyDriversCsv(db *gorm.DB, driversCsv *DriversCsv, table string) (int64, error) {
+	var copied int64
+
+	err := db.Connection(func(conn *gorm.DB) error {
+		sqlConn, ok := conn.Statement.ConnPool.(*sql.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected connection type %T", conn.Statement.ConnPool)
+		}
+
+		return sqlConn.Raw(func(driverConn any) error {
+			pgxConn, ok := driverConn.(*stdlib.Conn)
+			if !ok {
+				return fmt.Errorf("unsupported database driver %T", driverConn)
+			}
+
+			var err error
+			copied, err = pgxConn.Conn().CopyFrom(
+				context.Background(),
+				pgx.Identifier{table},
+				stagingColumns,
+				&driversCsvCopySource{driversCsv: driversCsv},
+			)
+			return err
+		})
+	})
+
+	return copied, err
 }
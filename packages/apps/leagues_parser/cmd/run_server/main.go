@@ -5,10 +5,11 @@ import (
 	"log"
 	"os"
 
-	"cloud.google.com/go/pubsub"
 	"github.com/joho/godotenv"
 	"riccardotornesello.it/sharedtelemetry/iracing/gorm_utils/database"
+	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
 	"riccardotornesello.it/sharedtelemetry/iracing/leagues_parser/logic"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue/transport"
 )
 
 func main() {
@@ -21,8 +22,11 @@ func main() {
 	dbPort := os.Getenv("DB_PORT")
 	dbHost := os.Getenv("DB_HOST")
 
+	iRacingEmail := os.Getenv("IRACING_EMAIL")
+	iRacingPassword := os.Getenv("IRACING_PASSWORD")
+
+	queueDriver := os.Getenv("QUEUE_DRIVER")
 	pubSubProjectId := os.Getenv("PUBSUB_PROJECT")
-	pubSubTopicId := os.Getenv("PUBSUB_TOPIC")
 
 	// Initialize database
 	db, err := database.Connect(dbUser, dbPass, dbHost, dbPort, dbName, 1, 0)
@@ -31,21 +35,32 @@ func main() {
 		return
 	}
 
-	// Initialize pubsub
-	pubSubCtx := context.Background()
-	client, err := pubsub.NewClient(pubSubCtx, pubSubProjectId)
+	// Initialize iRacing client
+	irClient, err := irapi.NewIRacingApiClient(iRacingEmail, iRacingPassword)
 	if err != nil {
-		log.Fatalf("pubsub.NewClient: %v", err)
+		log.Fatalf("irapi.NewIRacingApiClient: %v", err)
 		return
 	}
-	defer client.Close()
 
-	pubSubTopic := client.Topic(pubSubTopicId)
+	// Initialize queue
+	queueCtx := context.Background()
+	queueConfig := transport.Config{
+		Driver:          queueDriver,
+		PubSubProjectId: pubSubProjectId,
+		Db:              db,
+	}
+
+	publisher, err := queueConfig.NewPublisher(queueCtx, transport.SeasonsTopic())
+	if err != nil {
+		log.Fatalf("queueConfig.NewPublisher: %v", err)
+		return
+	}
+	defer publisher.Close()
 
 	// Start the job
 	log.Println("Starting job")
 
-	err = logic.FeedLeagues(db, pubSubTopic, pubSubCtx)
+	err = logic.FeedLeagues(db, irClient, publisher, queueCtx)
 	if err != nil {
 		log.Fatalf("logic.FeedLeagues: %v", err)
 		return
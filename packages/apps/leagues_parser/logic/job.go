@@ -2,47 +2,89 @@ package logic
 
 import (
 	"context"
+	"errors"
 	"fmt"
-	"strconv"
-	"sync"
-	"sync/atomic"
+	"log/slog"
+	"time"
 
-	"cloud.google.com/go/pubsub"
 	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
+	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
 )
 
-func FeedLeagues(db *gorm.DB, pubSubTopic *pubsub.Topic, pubSubCtx context.Context) error {
-	// Get active league seasons
-	seasonInfos, err := GetActiveLeagueSeasonIds(db)
+// The time given to the season parser to sync a season and schedule the next sync.
+// If it is not done in time, e.g. because the message was lost, the season is sent again.
+const seasonSyncLease = 30 * time.Minute
+
+// FeedLeagues discovers the seasons of the tracked leagues and sends to be parsed
+// the active ones whose next sync is due.
+func FeedLeagues(db *gorm.DB, irClient *irapi.IRacingApiClient, publisher queue.Publisher, ctx context.Context) error {
+	discoveryErr := DiscoverLeagues(db, irClient)
+
+	// Get the seasons to sync
+	now := time.Now()
+	seasonInfos, err := GetDueLeagueSeasonIds(db, now)
 	if err != nil {
 		return err
 	}
 
-	// Send pub/sub messages to parse the season
-	var wg sync.WaitGroup
-	var totalErrors uint64
-
-	for _, season := range seasonInfos {
-		result := pubSubTopic.Publish(pubSubCtx, &pubsub.Message{
-			Data: []byte("{\"leagueId\":" + strconv.Itoa(season.LeagueId) + ",\"seasonId\":" + strconv.Itoa(season.SeasonId) + "}"),
-		})
-
-		wg.Add(1)
-		go func(res *pubsub.PublishResult) {
-			defer wg.Done()
-			_, err := res.Get(pubSubCtx)
-			if err != nil {
-				atomic.AddUint64(&totalErrors, 1)
-				return
+	// Take the lease before sending the messages, so that a fast season parser
+	// records its sync after it and its next sync is not overwritten
+	if err := ScheduleLeagueSeasons(db, seasonInfos, now, now.Add(seasonSyncLease)); err != nil {
+		return err
+	}
+
+	// Send the messages to parse the seasons.
+	// If it fails, the seasons are sent again when the lease expires.
+	if err := SendSeasonsToParse(publisher, ctx, seasonInfos); err != nil {
+		return err
+	}
+
+	slog.Info(fmt.Sprintf("%d seasons sent to be parsed", len(seasonInfos)))
+
+	return discoveryErr
+}
+
+// DiscoverLeagues syncs the metadata and discovers the seasons of the tracked leagues, when stale.
+// A failure of a league doesn't stop the others.
+func DiscoverLeagues(db *gorm.DB, irClient *irapi.IRacingApiClient) error {
+	var leagues []events_models.League
+	if err := db.Find(&leagues).Error; err != nil {
+		return err
+	}
+
+	var discoveryErrors []error
+	now := time.Now()
+	for _, league := range leagues {
+		if IsLeagueMetadataStale(&league, now) {
+			if err := SyncLeagueMetadata(league.LeagueID, irClient, db); err != nil {
+				slog.Error(fmt.Sprintf("Error syncing the metadata of league %d: %v", league.LeagueID, err))
+				discoveryErrors = append(discoveryErrors, fmt.Errorf("league %d metadata: %w", league.LeagueID, err))
 			}
-		}(result)
+		}
+
+		if !IsLeagueSeasonsDiscoveryStale(&league, now) {
+			continue
+		}
+
+		if _, err := DiscoverLeagueSeasons(league.LeagueID, false, irClient, db); err != nil {
+			slog.Error(fmt.Sprintf("Error discovering the seasons of league %d: %v", league.LeagueID, err))
+			discoveryErrors = append(discoveryErrors, fmt.Errorf("league %d: %w", league.LeagueID, err))
+		}
 	}
 
-	wg.Wait()
+	return errors.Join(discoveryErrors...)
+}
 
-	if totalErrors > 0 {
-		return fmt.Errorf("Failed to send %d pub/sub messages", totalErrors)
+func SendSeasonsToParse(publisher queue.Publisher, ctx context.Context, seasons []SeasonInfo) error {
+	messages := make([]queue.SeasonMessage, len(seasons))
+	for i, season := range seasons {
+		messages[i] = queue.SeasonMessage{
+			LeagueId: season.LeagueId,
+			SeasonId: season.SeasonId,
+		}
 	}
 
-	return nil
+	return queue.PublishJSON(ctx, publisher, messages...)
 }
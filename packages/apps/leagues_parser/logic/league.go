@@ -1,6 +1,8 @@
 package logic
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
 )
@@ -12,7 +14,7 @@ type SeasonInfo struct {
 
 func GetActiveLeagueSeasonIds(db *gorm.DB) ([]SeasonInfo, error) {
 	var leagueSeasons []events_models.LeagueSeason
-	err := db.Model(&events_models.LeagueSeason{}).Find(&leagueSeasons).Error
+	err := db.Model(&events_models.LeagueSeason{}).Where("active = ?", true).Find(&leagueSeasons).Error
 	if err != nil {
 		return nil, err
 	}
@@ -27,3 +29,52 @@ func GetActiveLeagueSeasonIds(db *gorm.DB) ([]SeasonInfo, error) {
 
 	return seasonInfos, nil
 }
+
+// GetDueLeagueSeasonIds returns the active seasons which were never synced or whose next sync is due,
+// the ones waiting for the longest time first.
+func GetDueLeagueSeasonIds(db *gorm.DB, now time.Time) ([]SeasonInfo, error) {
+	var leagueSeasons []events_models.LeagueSeason
+	err := db.
+		Model(&events_models.LeagueSeason{}).
+		Where("active = ?", true).
+		Where("next_sync_at IS NULL OR next_sync_at <= ?", now).
+		Order("next_sync_at NULLS FIRST").
+		Find(&leagueSeasons).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	seasonInfos := make([]SeasonInfo, len(leagueSeasons))
+	for i, leagueSeason := range leagueSeasons {
+		seasonInfos[i] = SeasonInfo{
+			LeagueId: leagueSeason.LeagueID,
+			SeasonId: leagueSeason.SeasonID,
+		}
+	}
+
+	return seasonInfos, nil
+}
+
+// ScheduleLeagueSeasons marks as queued the seasons sent to be parsed and postpones their next sync,
+// so that they are not sent again before the season parser schedules the following one.
+func ScheduleLeagueSeasons(db *gorm.DB, seasons []SeasonInfo, queuedAt time.Time, nextSyncAt time.Time) error {
+	if len(seasons) == 0 {
+		return nil
+	}
+
+	seasonIds := make([][]int, len(seasons))
+	for i, season := range seasons {
+		seasonIds[i] = []int{season.LeagueId, season.SeasonId}
+	}
+
+	return db.
+		Model(&events_models.LeagueSeason{}).
+		Where("(league_id, season_id) IN ?", seasonIds).
+		Updates(map[string]any{
+			"sync_status":    events_models.IngestionStatusQueued,
+			"sync_queued_at": queuedAt,
+			"next_sync_at":   nextSyncAt,
+		}).
+		Error
+}
@@ -0,0 +1,40 @@
+package logic
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
+	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
+)
+
+// The league metadata rarely changes, so it is not refreshed at each run
+const leagueMetadataMaxAge = 24 * time.Hour
+
+// IsLeagueMetadataStale returns true if the league metadata was never synced or is older than the max age.
+func IsLeagueMetadataStale(league *events_models.League, now time.Time) bool {
+	return league.MetadataSyncedAt == nil || now.Sub(*league.MetadataSyncedAt) > leagueMetadataMaxAge
+}
+
+// SyncLeagueMetadata stores the league name, owner, description, links, logos, roster count and rules.
+func SyncLeagueMetadata(leagueId int, irClient *irapi.IRacingApiClient, db *gorm.DB) error {
+	league, err := irClient.GetLeague(leagueId, false)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	return db.Model(&events_models.League{}).Where("league_id = ?", leagueId).Updates(map[string]any{
+		"name":               league.LeagueName,
+		"owner_cust_id":      league.Owner.CustId,
+		"owner_name":         league.Owner.DisplayName,
+		"about":              league.About,
+		"url":                league.Url,
+		"small_logo":         league.Image.SmallLogo,
+		"large_logo":         league.Image.LargeLogo,
+		"roster_count":       league.RosterCount,
+		"rules":              league.Rules,
+		"metadata_synced_at": now,
+	}).Error
+}
@@ -0,0 +1,113 @@
+package logic
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
+	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+)
+
+// The seasons of a league rarely change, so they are not discovered at each run
+const leagueSeasonsDiscoveryMaxAge = 6 * time.Hour
+
+// IsLeagueSeasonsDiscoveryStale returns true if the seasons of the league were never discovered
+// or the last discovery is older than the max age.
+func IsLeagueSeasonsDiscoveryStale(league *events_models.League, now time.Time) bool {
+	return league.SeasonsDiscoveredAt == nil || now.Sub(*league.SeasonsDiscoveredAt) > leagueSeasonsDiscoveryMaxAge
+}
+
+// DiscoverLeagueSeasons stores the league with its seasons and their metadata and returns the active ones,
+// or all of them, including the retired ones, if retired is true.
+// The stored seasons which are not returned by iRacing anymore are marked as not active.
+func DiscoverLeagueSeasons(leagueId int, retired bool, irClient *irapi.IRacingApiClient, db *gorm.DB) ([]SeasonInfo, error) {
+	seasons, err := irClient.GetLeagueSeasons(leagueId, retired)
+	if err != nil {
+		return nil, err
+	}
+
+	leagueSeasons := make([]events_models.LeagueSeason, len(seasons.Seasons))
+	seasonIds := make([]int, len(seasons.Seasons))
+	discoveredSeasons := make([]SeasonInfo, 0)
+	for i, season := range seasons.Seasons {
+		leagueSeasons[i] = events_models.LeagueSeason{
+			LeagueID:         leagueId,
+			SeasonID:         season.SeasonId,
+			Name:             season.SeasonName,
+			Active:           season.Active,
+			Hidden:           season.Hidden,
+			PointsSystemID:   season.PointsSystemId,
+			PointsSystemName: season.PointsSystemName,
+		}
+		seasonIds[i] = season.SeasonId
+
+		if season.Active || retired {
+			discoveredSeasons = append(discoveredSeasons, SeasonInfo{
+				LeagueId: leagueId,
+				SeasonId: season.SeasonId,
+			})
+		}
+	}
+
+	tx := db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&events_models.League{LeagueID: leagueId}).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if len(leagueSeasons) > 0 {
+		err = tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "league_id"}, {Name: "season_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"updated_at", "name", "active", "hidden", "points_system_id", "points_system_name"}),
+		}).Omit("League").Create(leagueSeasons).Error
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+	}
+
+	missing := tx.Model(&events_models.LeagueSeason{}).Where("league_id = ?", leagueId)
+	if len(seasonIds) > 0 {
+		missing = missing.Where("season_id NOT IN ?", seasonIds)
+	}
+	if err := missing.Update("active", false).Error; err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	err = tx.Model(&events_models.League{}).Where("league_id = ?", leagueId).Update("seasons_discovered_at", time.Now()).Error
+	if err != nil {
+		tx.Rollback()
+		return nil, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return nil, err
+	}
+
+	return discoveredSeasons, nil
+}
+
+// SyncLeague syncs the metadata and discovers the seasons of the league, then sends the active ones to be parsed.
+func SyncLeague(leagueId int, irClient *irapi.IRacingApiClient, db *gorm.DB, publisher queue.Publisher, ctx context.Context) error {
+	activeSeasons, err := DiscoverLeagueSeasons(leagueId, false, irClient, db)
+	if err != nil {
+		return err
+	}
+
+	if err := SyncLeagueMetadata(leagueId, irClient, db); err != nil {
+		return err
+	}
+
+	return SendSeasonsToParse(publisher, ctx, activeSeasons)
+}
@@ -2,29 +2,26 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"io"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
-	"cloud.google.com/go/pubsub"
-	"gorm.io/gorm"
-	"riccardotornesello.it/sharedtelemetry/iracing/cloudrun_utils/handlers"
+	"riccardotornesello.it/sharedtelemetry/iracing/cloudrun_utils/jobs"
 	"riccardotornesello.it/sharedtelemetry/iracing/gorm_utils/database"
 	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue/outbox"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue/transport"
 	"riccardotornesello.it/sharedtelemetry/iracing/season_parser/logic"
 )
 
-var db *gorm.DB
-var irClient *irapi.IRacingApiClient
-var pubSubTopic *pubsub.Topic
-var pubSubCtx context.Context
+const serviceName = "season_parser"
+const relayInterval = 1 * time.Minute
 
 func main() {
-	var err error
-
 	// Get configuration
 	dbUser := os.Getenv("DB_USER")
 	dbPass := os.Getenv("DB_PASS")
@@ -35,33 +32,54 @@ func main() {
 	iRacingEmail := os.Getenv("IRACING_EMAIL")
 	iRacingPassword := os.Getenv("IRACING_PASSWORD")
 
+	// The topic is the one of the sessions downloader
+	queueDriver := os.Getenv("QUEUE_DRIVER")
+	queueWorkers, _ := strconv.Atoi(os.Getenv("QUEUE_WORKERS"))
 	pubSubProjectId := os.Getenv("PUBSUB_PROJECT")
-	pubSubTopicId := os.Getenv("PUBSUB_TOPIC")
 
 	// Initialize database
-	db, err = database.Connect(dbUser, dbPass, dbHost, dbPort, dbName, 2, 2)
+	db, err := database.Connect(dbUser, dbPass, dbHost, dbPort, dbName, 2, 2)
 	if err != nil {
 		log.Fatalf("database.Connect: %v", err)
 	}
 
 	// Initialize iRacing client
-	irClient, err = irapi.NewIRacingApiClient(iRacingEmail, iRacingPassword)
+	irClient, err := irapi.NewIRacingApiClient(iRacingEmail, iRacingPassword)
 	if err != nil {
 		log.Fatalf("irapi.NewIRacingApiClient: %v", err)
 	}
 
-	// Initialize Pub/Sub client
-	pubSubCtx = context.Background()
-	client, err := pubsub.NewClient(pubSubCtx, pubSubProjectId)
+	// Initialize queue
+	queueCtx := context.Background()
+	queueConfig := transport.Config{
+		Driver:          queueDriver,
+		PubSubProjectId: pubSubProjectId,
+		Db:              db,
+		Workers:         queueWorkers,
+	}
+
+	publisher, err := queueConfig.NewPublisher(queueCtx, transport.SessionsTopic())
 	if err != nil {
-		log.Fatalf("pubsub.NewClient: %v", err)
+		log.Fatalf("queueConfig.NewPublisher: %v", err)
 	}
-	defer client.Close()
+	defer publisher.Close()
+
+	relay := outbox.NewRelay(db, queue.SessionsTopic, publisher)
+	go relay.Run(queueCtx, relayInterval)
 
-	pubSubTopic = client.Topic(pubSubTopicId)
+	processMessage := logic.NewMessageHandler(irClient, db, relay)
+
+	err = queueConfig.Consume(queueCtx, http.DefaultServeMux, transport.SeasonsTopic(), jobs.Handler(db, serviceName, processMessage))
+	if err != nil {
+		log.Fatalf("queueConfig.Consume: %v", err)
+	}
 
 	// Start the HTTP server
-	http.HandleFunc("/", PubSubHandler)
+	// The failed jobs endpoints are exposed only when protected by the admin token
+	if adminToken := os.Getenv("ADMIN_TOKEN"); adminToken != "" {
+		http.HandleFunc("GET /failed-jobs", jobs.RequireToken(adminToken, jobs.ListFailedHandler(db, serviceName)))
+		http.HandleFunc("POST /failed-jobs/{id}/replay", jobs.RequireToken(adminToken, jobs.ReplayFailedHandler(db, serviceName, processMessage)))
+	}
 
 	port := os.Getenv("PORT")
 	if port == "" {
@@ -79,68 +97,3 @@ func main() {
 		log.Fatal(err)
 	}
 }
-
-type PubSubMessage struct {
-	Message struct {
-		Data []byte `json:"data,omitempty"`
-		ID   string `json:"id"`
-	} `json:"message"`
-	Subscription string `json:"subscription"`
-}
-
-type SeasonData struct {
-	LeagueId int `json:"leagueId"`
-	SeasonId int `json:"seasonId"`
-}
-
-func PubSubHandler(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
-	defer r.Body.Close()
-	if err != nil {
-		handlers.ReturnException(w, err, "io.ReadAll")
-		return
-	}
-
-	var m PubSubMessage
-	if err := json.Unmarshal(body, &m); err != nil {
-		handlers.ReturnException(w, err, "json.Unmarshal")
-		return
-	}
-
-	var seasonData SeasonData
-	if err := json.Unmarshal(m.Message.Data, &seasonData); err != nil {
-		handlers.ReturnException(w, err, "json.Unmarshal")
-		return
-	}
-
-	sessionInfo, err := logic.GetMissingSessionInfo(seasonData.LeagueId, seasonData.SeasonId, irClient, db)
-	if err != nil {
-		handlers.ReturnException(w, err, "logic.GetMissingSessionInfo")
-		return
-	}
-
-	tx := db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
-		}
-	}()
-
-	err = logic.StoreMissingSessions(sessionInfo, tx)
-
-	err = logic.SendSessionsToParse(pubSubTopic, pubSubCtx, sessionInfo)
-	if err != nil {
-		tx.Rollback()
-		handlers.ReturnException(w, err, "logic.SendSessionsToParse")
-		return
-	}
-
-	err = tx.Commit().Error
-	if err != nil {
-		handlers.ReturnException(w, err, "tx.Commit")
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-	return
-}
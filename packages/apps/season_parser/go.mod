@@ -3,13 +3,14 @@ module riccardotornesello.it/sharedtelemetry/iracing/season_parser
 go 1.23.2
 
 require (
-	cloud.google.com/go/pubsub v1.45.3
 	github.com/joho/godotenv v1.5.1
+	github.com/lib/pq v1.10.9
 	gorm.io/gorm v1.25.12
 	riccardotornesello.it/sharedtelemetry/iracing/cloudrun_utils v0.0.0-00010101000000-000000000000
 	riccardotornesello.it/sharedtelemetry/iracing/events_models v0.0.0-00010101000000-000000000000
 	riccardotornesello.it/sharedtelemetry/iracing/gorm_utils v0.0.0-00010101000000-000000000000
 	riccardotornesello.it/sharedtelemetry/iracing/irapi v0.0.0-00010101000000-000000000000
+	riccardotornesello.it/sharedtelemetry/iracing/queue v0.0.0-00010101000000-000000000000
 )
 
 replace (
@@ -17,6 +18,7 @@ replace (
 	riccardotornesello.it/sharedtelemetry/iracing/events_models => ../../libs/events_models
 	riccardotornesello.it/sharedtelemetry/iracing/gorm_utils => ../../libs/gorm_utils
 	riccardotornesello.it/sharedtelemetry/iracing/irapi => ../../libs/irapi
+	riccardotornesello.it/sharedtelemetry/iracing/queue => ../../libs/queue
 )
 
 require (
@@ -25,6 +27,7 @@ require (
 	cloud.google.com/go/auth/oauth2adapt v0.2.6 // indirect
 	cloud.google.com/go/compute/metadata v0.5.2 // indirect
 	cloud.google.com/go/iam v1.2.2 // indirect
+	cloud.google.com/go/pubsub v1.45.3 // indirect
 	github.com/felixge/httpsnoop v1.0.4 // indirect
 	github.com/go-logr/logr v1.4.2 // indirect
 	github.com/go-logr/stdr v1.2.2 // indirect
@@ -39,7 +42,6 @@ require (
 	github.com/jackc/puddle/v2 v2.2.1 // indirect
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
-	github.com/lib/pq v1.10.9 // indirect
 	go.opencensus.io v0.24.0 // indirect
 	go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc v0.54.0 // indirect
 	go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp v0.54.0 // indirect
@@ -0,0 +1,108 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/cloudrun_utils/jobs"
+	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue/outbox"
+)
+
+// NewMessageHandler returns the handler of the season parser messages, which stores and
+// sends to the sessions downloader the new sessions of the season described by the message.
+// The messages are written to the outbox and sent by the relay.
+func NewMessageHandler(irClient *irapi.IRacingApiClient, db *gorm.DB, relay *outbox.Relay) queue.Handler {
+	return func(ctx context.Context, data []byte) error {
+		seasonData, err := queue.DecodeJSON[queue.SeasonMessage](data)
+		if err != nil {
+			return jobs.Permanent(fmt.Errorf("queue.DecodeJSON: %w", err))
+		}
+
+		if err := StartSeasonSync(seasonData.LeagueId, seasonData.SeasonId, db); err != nil {
+			slog.Error(fmt.Sprintf("Error starting the sync of season %d: %v", seasonData.SeasonId, err))
+		}
+
+		// The outcome is recorded to schedule the next sync of the season
+		err = syncSeason(seasonData.LeagueId, seasonData.SeasonId, irClient, db, relay, ctx)
+		if recordErr := RecordSeasonSync(seasonData.LeagueId, seasonData.SeasonId, err, db); recordErr != nil {
+			slog.Error(fmt.Sprintf("Error recording the sync of season %d: %v", seasonData.SeasonId, recordErr))
+		}
+
+		return err
+	}
+}
+
+func syncSeason(leagueId int, seasonId int, irClient *irapi.IRacingApiClient, db *gorm.DB, relay *outbox.Relay, ctx context.Context) error {
+	changes, err := GetSeasonChanges(leagueId, seasonId, irClient, db)
+	if err != nil {
+		if irapi.IsPermanentError(err) {
+			err = jobs.Permanent(err)
+		}
+		return fmt.Errorf("logic.GetSeasonChanges: %w", err)
+	}
+
+	// The sessions and the messages to parse them are stored in the same transaction,
+	// then the relay sends the messages only after the commit
+	tx := db.Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	err = StoreSeasonSessions(changes.Sessions, tx)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("logic.StoreSeasonSessions: %w", err)
+	}
+
+	err = DeleteSessions(changes.RemovedSessions, tx)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("logic.DeleteSessions: %w", err)
+	}
+
+	err = UpdateEventGroupDates(leagueId, seasonId, tx)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("logic.UpdateEventGroupDates: %w", err)
+	}
+
+	createdSessions, err := StoreMissingSessions(changes.MissingSessions, tx)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("logic.StoreMissingSessions: %w", err)
+	}
+
+	// The changed sessions are parsed again, replacing their data
+	sessionsToParse := append(createdSessions, changes.ChangedSessions...)
+
+	err = QueueChangedSessions(changes.ChangedSessions, tx)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("logic.QueueChangedSessions: %w", err)
+	}
+
+	err = SendSessionsToParse(relay.NewPublisher(tx), ctx, sessionsToParse)
+	if err != nil {
+		tx.Rollback()
+		return fmt.Errorf("logic.SendSessionsToParse: %w", err)
+	}
+
+	err = tx.Commit().Error
+	if err != nil {
+		return fmt.Errorf("tx.Commit: %w", err)
+	}
+
+	// If the relay fails, the message is delivered again and the pending messages
+	// are sent by the next flush, without storing the sessions twice
+	if _, err := relay.Flush(ctx); err != nil {
+		return fmt.Errorf("relay.Flush: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package logic
+
+import (
+	"database/sql"
+	"time"
+
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
+)
+
+const (
+	minSyncInterval = 5 * time.Minute
+	maxSyncInterval = 24 * time.Hour
+)
+
+// The seasons are synced more frequently the closer their nearest session is,
+// either launched recently (late results) or upcoming.
+var syncIntervals = []struct {
+	nearestSession time.Duration
+	interval       time.Duration
+}{
+	{12 * time.Hour, minSyncInterval},
+	{3 * 24 * time.Hour, 1 * time.Hour},
+	{14 * 24 * time.Hour, 6 * time.Hour},
+}
+
+// NextSyncInterval returns the time to wait before the next sync of a season, given the distance
+// from its nearest session (nil if the season has no sessions) and the consecutive failed syncs.
+// The failed syncs are retried with an exponential backoff.
+func NextSyncInterval(nearestSession *time.Duration, failures int) time.Duration {
+	if failures > 0 {
+		backoff := minSyncInterval
+		for i := 1; i < failures && backoff < maxSyncInterval; i++ {
+			backoff *= 2
+		}
+
+		return min(backoff, maxSyncInterval)
+	}
+
+	if nearestSession == nil {
+		return maxSyncInterval
+	}
+
+	for _, step := range syncIntervals {
+		if *nearestSession <= step.nearestSession {
+			return step.interval
+		}
+	}
+
+	return maxSyncInterval
+}
+
+// GetNearestSessionDistance returns the distance from now of the nearest session of the season's
+// schedule, in the past or in the future, or nil if the schedule is empty.
+func GetNearestSessionDistance(leagueId int, seasonId int, now time.Time, db *gorm.DB) (*time.Duration, error) {
+	var seconds sql.NullFloat64
+	err := db.
+		Model(&events_models.LeagueSeasonSession{}).
+		Select("MIN(ABS(EXTRACT(EPOCH FROM (launch_at - ?))))", now).
+		Where("league_id = ? AND season_id = ?", leagueId, seasonId).
+		Scan(&seconds).
+		Error
+	if err != nil {
+		return nil, err
+	}
+
+	if !seconds.Valid {
+		return nil, nil
+	}
+
+	distance := time.Duration(seconds.Float64 * float64(time.Second))
+	return &distance, nil
+}
+
+// RecordSeasonSync stores the outcome of the sync of a season and schedules the next one.
+func RecordSeasonSync(leagueId int, seasonId int, syncErr error, db *gorm.DB) error {
+	now := time.Now()
+
+	var leagueSeason events_models.LeagueSeason
+	err := db.Where("league_id = ? AND season_id = ?", leagueId, seasonId).Limit(1).Find(&leagueSeason).Error
+	if err != nil {
+		return err
+	}
+
+	// The season may not be tracked, e.g. when it is synced manually
+	if leagueSeason.LeagueID == 0 {
+		return nil
+	}
+
+	updates := map[string]any{
+		"sync_status":     events_models.IngestionStatusParsed,
+		"last_sync_at":    now,
+		"last_sync_error": "",
+		"sync_failures":   0,
+	}
+
+	var nearestSession *time.Duration
+	failures := 0
+	if syncErr != nil {
+		failures = leagueSeason.SyncFailures + 1
+		updates["sync_status"] = events_models.IngestionStatusFailed
+		updates["last_sync_error"] = syncErr.Error()
+		updates["sync_failures"] = failures
+	} else {
+		nearestSession, err = GetNearestSessionDistance(leagueId, seasonId, now, db)
+		if err != nil {
+			return err
+		}
+	}
+
+	updates["next_sync_at"] = now.Add(NextSyncInterval(nearestSession, failures))
+
+	return db.Model(&leagueSeason).Updates(updates).Error
+}
+
+// StartSeasonSync marks the sync of a season as in progress.
+func StartSeasonSync(leagueId int, seasonId int, db *gorm.DB) error {
+	return db.
+		Model(&events_models.LeagueSeason{}).
+		Where("league_id = ? AND season_id = ?", leagueId, seasonId).
+		Updates(map[string]any{
+			"sync_status":     events_models.IngestionStatusDownloading,
+			"sync_started_at": time.Now(),
+		}).
+		Error
+}
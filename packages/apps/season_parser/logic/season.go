@@ -3,107 +3,315 @@ package logic
 import (
 	"context"
 	"fmt"
-	"strconv"
-	"sync"
-	"sync/atomic"
+	"log/slog"
+	"time"
 
-	"cloud.google.com/go/pubsub"
+	"github.com/lib/pq"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
 	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
 )
 
 type SessionInfo struct {
 	SubsessionId int
 	LaunchAt     string
+	Refresh      bool
 }
 
-func GetMissingSessionInfo(leagueId int, seasonId int, irClient *irapi.IRacingApiClient, db *gorm.DB) ([]SessionInfo, error) {
-	// Extract the sessions list (only the completed ones) for the specified series and league
-	sessions, err := irClient.GetLeagueSeasonSessions(leagueId, seasonId, true)
+// resultsSettleTime is the time after the launch of a session after which its results
+// are considered final. A session parsed before it is parsed once more after it,
+// to get the results re-scored without changes of the session metadata.
+const resultsSettleTime = 24 * time.Hour
+
+// SeasonChanges contains the sessions of a season to store, to parse and to delete.
+type SeasonChanges struct {
+	Sessions        []events_models.LeagueSeasonSession // Metadata of all the sessions of the season
+	MissingSessions []SessionInfo                       // Sessions not yet in the database
+	ChangedSessions []SessionInfo                       // Stored sessions whose status or results changed since the last sync
+	RemovedSessions []int                               // Stored subsessions which no longer have results, e.g. cancelled or replaced
+}
+
+func GetSeasonChanges(leagueId int, seasonId int, irClient *irapi.IRacingApiClient, db *gorm.DB) (*SeasonChanges, error) {
+	// Extract the sessions list, including the scheduled ones, for the specified series and league
+	sessions, err := irClient.GetLeagueSeasonSessions(leagueId, seasonId, false)
 	if err != nil {
 		return nil, err
 	}
 
-	// Get the sessions which are not already stored in the database
-	sessionIds := make([]int, len(sessions.Sessions))
-	for i, session := range sessions.Sessions {
-		sessionIds[i] = session.SubsessionId
+	// Get the sessions metadata of the last sync
+	var storedMetadata []events_models.LeagueSeasonSession
+	if err := db.Where("league_id = ? AND season_id = ?", leagueId, seasonId).Find(&storedMetadata).Error; err != nil {
+		return nil, err
 	}
 
-	var storedSessions []events_models.Session
-	db.Where("subsession_id IN ?", sessionIds).Find(&storedSessions)
-	storedSessionIds := make(map[int]bool)
-	for _, storedSession := range storedSessions {
-		storedSessionIds[int(storedSession.SubsessionID)] = true
+	previousMetadata := make(map[int]events_models.LeagueSeasonSession)
+	for _, metadata := range storedMetadata {
+		previousMetadata[metadata.SessionID] = metadata
 	}
 
-	// Return the sessions which are not already stored in the database
-	missingSessions := make([]SessionInfo, 0)
+	// Get the sessions which are already stored in the database,
+	// including the ones of the last sync which could have been removed
+	sessionIds := make([]int, 0, len(sessions.Sessions)+len(storedMetadata))
 	for _, session := range sessions.Sessions {
-		if _, ok := storedSessionIds[int(session.SubsessionId)]; !ok {
-			missingSessions = append(missingSessions, SessionInfo{
-				SubsessionId: session.SubsessionId,
-				LaunchAt:     session.LaunchAt,
-			})
+		if session.SubsessionId != 0 {
+			sessionIds = append(sessionIds, session.SubsessionId)
+		}
+	}
+	for _, metadata := range storedMetadata {
+		if metadata.SubsessionID != 0 {
+			sessionIds = append(sessionIds, metadata.SubsessionID)
 		}
 	}
 
-	return missingSessions, nil
-}
+	var storedSessions []events_models.Session
+	if err := db.Where("subsession_id IN ?", sessionIds).Find(&storedSessions).Error; err != nil {
+		return nil, err
+	}
 
-func SendSessionsToParse(pubSubTopic *pubsub.Topic, pubSubCtx context.Context, sessions []SessionInfo) error {
-	if sessions == nil || len(sessions) == 0 {
-		return nil
+	storedSessionsById := make(map[int]events_models.Session)
+	for _, storedSession := range storedSessions {
+		storedSessionsById[storedSession.SubsessionID] = storedSession
 	}
 
-	var wg sync.WaitGroup
-	var totalErrors uint64
+	return compareSeasonSessions(leagueId, seasonId, sessions.Sessions, storedSessionsById, previousMetadata, time.Now()), nil
+}
 
+// compareSeasonSessions compares the sessions of the season listed by iRacing with the
+// stored sessions and with the metadata of the last sync.
+// The sessions with an invalid launch time are skipped.
+func compareSeasonSessions(leagueId int, seasonId int, sessions []irapi.LeagueSeasonSession, storedSessions map[int]events_models.Session, previousMetadata map[int]events_models.LeagueSeasonSession, now time.Time) *SeasonChanges {
+	changes := &SeasonChanges{
+		Sessions:        make([]events_models.LeagueSeasonSession, 0, len(sessions)),
+		MissingSessions: make([]SessionInfo, 0),
+		ChangedSessions: make([]SessionInfo, 0),
+		RemovedSessions: make([]int, 0),
+	}
+
+	listedSessions := make(map[int]bool)
 	for _, session := range sessions {
-		result := pubSubTopic.Publish(pubSubCtx, &pubsub.Message{
-			Data: []byte("{\"subsessionId\":" + strconv.Itoa(int(session.SubsessionId)) + ",\"launchAt\":\"" + session.LaunchAt + "\"}"),
-		})
-
-		wg.Add(1)
-		go func(res *pubsub.PublishResult) {
-			defer wg.Done()
-			_, err := res.Get(pubSubCtx)
-			if err != nil {
-				atomic.AddUint64(&totalErrors, 1)
-				return
+		listedSessions[session.SessionId] = true
+
+		launchAt, err := time.Parse(time.RFC3339, session.LaunchAt)
+		if err != nil {
+			slog.Warn(fmt.Sprintf("Skipping session %d of league %d season %d: invalid launch time: %v", session.SessionId, leagueId, seasonId, err))
+			continue
+		}
+
+		carIds := make(pq.Int64Array, len(session.Cars))
+		for i, car := range session.Cars {
+			carIds[i] = int64(car.CarId)
+		}
+
+		metadata := events_models.LeagueSeasonSession{
+			LeagueID:       leagueId,
+			SeasonID:       seasonId,
+			SessionID:      session.SessionId,
+			SubsessionID:   session.SubsessionId,
+			Status:         session.Status,
+			HasResults:     session.HasResults,
+			EntryCount:     session.EntryCount,
+			TeamEntryCount: session.TeamEntryCount,
+			LaunchAt:       launchAt,
+
+			TrackID:           session.Track.TrackId,
+			TrackName:         session.Track.TrackName,
+			TrackConfigName:   session.Track.ConfigName,
+			CarIDs:            carIds,
+			PracticeLength:    session.PracticeLength,
+			QualifyLength:     session.QualifyLength,
+			QualifyLaps:       session.QualifyLaps,
+			RaceLength:        session.RaceLength,
+			RaceLaps:          session.RaceLaps,
+			PasswordProtected: session.PasswordProtected,
+		}
+		changes.Sessions = append(changes.Sessions, metadata)
+
+		// The sessions without metadata are the ones stored before the first sync
+		// which tracked them, so there is nothing to compare them to
+		previous, hasPrevious := previousMetadata[session.SessionId]
+
+		// The data of a subsession whose results are no longer available, or which was
+		// replaced by another subsession, is removed
+		if hasPrevious && previous.HasResults && (previous.SubsessionID != session.SubsessionId || !session.HasResults) {
+			if _, ok := storedSessions[previous.SubsessionID]; ok {
+				changes.RemovedSessions = append(changes.RemovedSessions, previous.SubsessionID)
 			}
-		}(result)
+		}
+
+		// The scheduled sessions are only stored in the calendar
+		if session.SubsessionId == 0 || !session.HasResults {
+			continue
+		}
+
+		sessionInfo := SessionInfo{
+			SubsessionId: session.SubsessionId,
+			LaunchAt:     session.LaunchAt,
+		}
+
+		storedSession, ok := storedSessions[session.SubsessionId]
+		if !ok {
+			changes.MissingSessions = append(changes.MissingSessions, sessionInfo)
+			continue
+		}
+
+		if (hasPrevious && isSessionChanged(&previous, &metadata)) || isSessionUnsettled(&storedSession, launchAt, now) {
+			sessionInfo.Refresh = true
+			changes.ChangedSessions = append(changes.ChangedSessions, sessionInfo)
+		}
 	}
 
-	wg.Wait()
+	// The sessions no longer listed, e.g. because they were cancelled, are removed too
+	for _, previous := range previousMetadata {
+		if listedSessions[previous.SessionID] || !previous.HasResults {
+			continue
+		}
 
-	if totalErrors > 0 {
-		return fmt.Errorf("%d of %d messages did not publish successfully", totalErrors, len(sessions))
+		if _, ok := storedSessions[previous.SubsessionID]; ok {
+			changes.RemovedSessions = append(changes.RemovedSessions, previous.SubsessionID)
+		}
 	}
 
-	return nil
+	return changes
 }
 
-func StoreMissingSessions(sessions []SessionInfo, db *gorm.DB) error {
-	if sessions == nil || len(sessions) == 0 {
+func isSessionChanged(previous *events_models.LeagueSeasonSession, current *events_models.LeagueSeasonSession) bool {
+	return previous.SubsessionID != current.SubsessionID ||
+		previous.Status != current.Status ||
+		previous.HasResults != current.HasResults ||
+		previous.EntryCount != current.EntryCount ||
+		previous.TeamEntryCount != current.TeamEntryCount
+}
+
+// isSessionUnsettled returns true if the session was parsed before its results were
+// considered final and the settle time has passed.
+func isSessionUnsettled(storedSession *events_models.Session, launchAt time.Time, now time.Time) bool {
+	settledAt := launchAt.Add(resultsSettleTime)
+	return storedSession.TrackID != 0 && storedSession.UpdatedAt.Before(settledAt) && now.After(settledAt)
+}
+
+// DeleteSessions deletes the subsessions with their simsessions, participants and laps,
+// which are deleted by the foreign keys cascade.
+func DeleteSessions(subsessionIds []int, db *gorm.DB) error {
+	if len(subsessionIds) == 0 {
+		return nil
+	}
+
+	return db.Unscoped().Where("subsession_id IN ?", subsessionIds).Delete(&events_models.Session{}).Error
+}
+
+// StoreSeasonSessions stores the sessions metadata, replacing the one of the last sync.
+func StoreSeasonSessions(sessions []events_models.LeagueSeasonSession, db *gorm.DB) error {
+	if len(sessions) == 0 {
 		return nil
 	}
 
-	dbSessions := make([]events_models.Session, len(sessions))
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "league_id"}, {Name: "season_id"}, {Name: "session_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"updated_at", "subsession_id", "status", "has_results", "entry_count", "team_entry_count", "launch_at",
+			"track_id", "track_name", "track_config_name", "car_ids",
+			"practice_length", "qualify_length", "qualify_laps", "race_length", "race_laps", "password_protected",
+		}),
+	}).Create(sessions).Error
+}
+
+// UpdateEventGroupDates sets the dates of the event groups with automatic dates
+// of the competitions based on the season, using the days of the scheduled sessions on their track.
+// The groups without sessions on their track keep their dates.
+func UpdateEventGroupDates(leagueId int, seasonId int, db *gorm.DB) error {
+	return db.Exec(`
+		UPDATE event_groups
+		SET dates = track_dates.dates, updated_at = NOW()
+		FROM competitions, (
+			SELECT track_id, array_agg(DISTINCT text(date(launch_at)) ORDER BY text(date(launch_at))) AS dates
+			FROM league_season_sessions
+			WHERE league_id = ?
+			AND season_id = ?
+			AND deleted_at IS NULL
+			GROUP BY track_id
+		) AS track_dates
+		WHERE competitions.id = event_groups.competition_id
+		AND competitions.league_id = ?
+		AND competitions.season_id = ?
+		AND track_dates.track_id = event_groups.i_racing_track_id
+		AND event_groups.auto_dates
+		AND event_groups.deleted_at IS NULL
+	`, leagueId, seasonId, leagueId, seasonId).Error
+}
+
+func SendSessionsToParse(publisher queue.Publisher, ctx context.Context, sessions []SessionInfo) error {
+	messages := make([]queue.SessionMessage, len(sessions))
+	for i, session := range sessions {
+		messages[i] = queue.SessionMessage{
+			SubsessionId: session.SubsessionId,
+			LaunchAt:     session.LaunchAt,
+			Refresh:      session.Refresh,
+		}
+	}
+
+	return queue.PublishJSON(ctx, publisher, messages...)
+}
+
+// StoreMissingSessions stores the sessions and returns the ones actually created,
+// ignoring the ones stored in the meantime by another execution.
+func StoreMissingSessions(sessions []SessionInfo, db *gorm.DB) ([]SessionInfo, error) {
+	if len(sessions) == 0 {
+		return nil, nil
+	}
 
+	subsessionIds := make(pq.Int64Array, len(sessions))
 	for i, session := range sessions {
-		dbSessions[i] = events_models.Session{
-			SubsessionID: session.SubsessionId,
+		subsessionIds[i] = int64(session.SubsessionId)
+	}
+
+	// Create all the sessions at once, ignoring the duplicates on SubsessionID,
+	// and get the IDs of the created ones
+	var createdIds []int
+	now := time.Now()
+	err := db.Raw(`
+		INSERT INTO sessions (subsession_id, created_at, updated_at, queued_at)
+		SELECT unnest(?::bigint[]), ?::timestamptz, ?::timestamptz, ?::timestamptz
+		ON CONFLICT (subsession_id) DO NOTHING
+		RETURNING subsession_id
+	`, subsessionIds, now, now, now).Scan(&createdIds).Error
+	if err != nil {
+		return nil, err
+	}
+
+	created := make(map[int]bool, len(createdIds))
+	for _, id := range createdIds {
+		created[id] = true
+	}
+
+	createdSessions := make([]SessionInfo, 0, len(createdIds))
+	for _, session := range sessions {
+		if created[session.SubsessionId] {
+			createdSessions = append(createdSessions, session)
 		}
 	}
 
-	// Create and ignore duplicates on SubsessionID
-	err := db.Clauses(clause.OnConflict{
-		Columns:   []clause.Column{{Name: "subsession_id"}},
-		DoNothing: true,
-	}).Create(dbSessions).Error
+	return createdSessions, nil
+}
+
+// QueueChangedSessions marks as queued the stored sessions sent to be parsed again.
+func QueueChangedSessions(sessions []SessionInfo, db *gorm.DB) error {
+	if len(sessions) == 0 {
+		return nil
+	}
+
+	subsessionIds := make([]int, len(sessions))
+	for i, session := range sessions {
+		subsessionIds[i] = session.SubsessionId
+	}
 
-	return err
+	return db.
+		Model(&events_models.Session{}).
+		Where("subsession_id IN ?", subsessionIds).
+		Updates(map[string]any{
+			"status":    events_models.IngestionStatusQueued,
+			"queued_at": time.Now(),
+		}).
+		Error
 }
@@ -0,0 +1,252 @@
+package logic
+
+import (
+	"os"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/lib/pq"
+	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
+	"riccardotornesello.it/sharedtelemetry/iracing/gorm_utils/database"
+	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
+)
+
+func TestCompareSeasonSessions(t *testing.T) {
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+	recentLaunch := now.Add(-2 * time.Hour)
+	oldLaunch := now.Add(-72 * time.Hour)
+
+	session := func(sessionId int, subsessionId int, launchAt time.Time, hasResults bool, entryCount int) irapi.LeagueSeasonSession {
+		return irapi.LeagueSeasonSession{
+			SessionId:    sessionId,
+			SubsessionId: subsessionId,
+			LaunchAt:     launchAt.Format(time.RFC3339),
+			HasResults:   hasResults,
+			EntryCount:   entryCount,
+		}
+	}
+	metadata := func(sessionId int, subsessionId int, launchAt time.Time, hasResults bool, entryCount int) events_models.LeagueSeasonSession {
+		return events_models.LeagueSeasonSession{
+			LeagueID:     1,
+			SeasonID:     2,
+			SessionID:    sessionId,
+			SubsessionID: subsessionId,
+			HasResults:   hasResults,
+			EntryCount:   entryCount,
+			LaunchAt:     launchAt,
+		}
+	}
+	parsed := func(subsessionId int, updatedAt time.Time) events_models.Session {
+		return events_models.Session{SubsessionID: subsessionId, TrackID: 10, UpdatedAt: updatedAt}
+	}
+
+	tests := []struct {
+		name     string
+		sessions []irapi.LeagueSeasonSession
+		stored   []events_models.Session
+		previous []events_models.LeagueSeasonSession
+		missing  []int
+		changed  []int
+		removed  []int
+	}{
+		{
+			name:     "new session",
+			sessions: []irapi.LeagueSeasonSession{session(1, 100, recentLaunch, true, 20)},
+			missing:  []int{100},
+		},
+		{
+			name:     "session without results",
+			sessions: []irapi.LeagueSeasonSession{session(1, 100, recentLaunch, false, 20)},
+		},
+		{
+			name:     "unchanged session",
+			sessions: []irapi.LeagueSeasonSession{session(1, 100, recentLaunch, true, 20)},
+			stored:   []events_models.Session{parsed(100, recentLaunch.Add(time.Hour))},
+			previous: []events_models.LeagueSeasonSession{metadata(1, 100, recentLaunch, true, 20)},
+		},
+		{
+			name:     "changed entry count",
+			sessions: []irapi.LeagueSeasonSession{session(1, 100, recentLaunch, true, 21)},
+			stored:   []events_models.Session{parsed(100, recentLaunch.Add(time.Hour))},
+			previous: []events_models.LeagueSeasonSession{metadata(1, 100, recentLaunch, true, 20)},
+			changed:  []int{100},
+		},
+		{
+			name:     "stored before the first sync",
+			sessions: []irapi.LeagueSeasonSession{session(1, 100, recentLaunch, true, 20)},
+			stored:   []events_models.Session{parsed(100, recentLaunch.Add(time.Hour))},
+		},
+		{
+			name:     "parsed before the results settled",
+			sessions: []irapi.LeagueSeasonSession{session(1, 100, oldLaunch, true, 20)},
+			stored:   []events_models.Session{parsed(100, oldLaunch.Add(time.Hour))},
+			previous: []events_models.LeagueSeasonSession{metadata(1, 100, oldLaunch, true, 20)},
+			changed:  []int{100},
+		},
+		{
+			name:     "parsed after the results settled",
+			sessions: []irapi.LeagueSeasonSession{session(1, 100, oldLaunch, true, 20)},
+			stored:   []events_models.Session{parsed(100, oldLaunch.Add(resultsSettleTime+time.Hour))},
+			previous: []events_models.LeagueSeasonSession{metadata(1, 100, oldLaunch, true, 20)},
+		},
+		{
+			name:     "not yet parsed",
+			sessions: []irapi.LeagueSeasonSession{session(1, 100, oldLaunch, true, 20)},
+			stored:   []events_models.Session{{SubsessionID: 100}},
+			previous: []events_models.LeagueSeasonSession{metadata(1, 100, oldLaunch, true, 20)},
+		},
+		{
+			name:     "results no longer available",
+			sessions: []irapi.LeagueSeasonSession{session(1, 100, recentLaunch, false, 20)},
+			stored:   []events_models.Session{parsed(100, recentLaunch.Add(time.Hour))},
+			previous: []events_models.LeagueSeasonSession{metadata(1, 100, recentLaunch, true, 20)},
+			removed:  []int{100},
+		},
+		{
+			name:     "subsession replaced",
+			sessions: []irapi.LeagueSeasonSession{session(1, 101, recentLaunch, true, 20)},
+			stored:   []events_models.Session{parsed(100, recentLaunch.Add(time.Hour))},
+			previous: []events_models.LeagueSeasonSession{metadata(1, 100, recentLaunch, true, 20)},
+			missing:  []int{101},
+			removed:  []int{100},
+		},
+		{
+			name:     "session no longer listed",
+			stored:   []events_models.Session{parsed(100, recentLaunch.Add(time.Hour))},
+			previous: []events_models.LeagueSeasonSession{metadata(1, 100, recentLaunch, true, 20)},
+			removed:  []int{100},
+		},
+		{
+			name:     "session no longer listed already removed",
+			previous: []events_models.LeagueSeasonSession{metadata(1, 100, recentLaunch, true, 20)},
+		},
+		{
+			name: "invalid launch time",
+			sessions: []irapi.LeagueSeasonSession{
+				{SessionId: 1, SubsessionId: 100, LaunchAt: "invalid", HasResults: true},
+				session(2, 200, recentLaunch, true, 20),
+			},
+			stored:   []events_models.Session{parsed(100, recentLaunch.Add(time.Hour))},
+			previous: []events_models.LeagueSeasonSession{metadata(1, 100, recentLaunch, true, 20)},
+			missing:  []int{200},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storedSessions := make(map[int]events_models.Session)
+			for _, stored := range tt.stored {
+				storedSessions[stored.SubsessionID] = stored
+			}
+
+			previousMetadata := make(map[int]events_models.LeagueSeasonSession)
+			for _, previous := range tt.previous {
+				previousMetadata[previous.SessionID] = previous
+			}
+
+			changes := compareSeasonSessions(1, 2, tt.sessions, storedSessions, previousMetadata, now)
+
+			if got := subsessionIds(changes.MissingSessions); !reflect.DeepEqual(got, sortedIds(tt.missing)) {
+				t.Errorf("missing sessions: got %v, expected %v", got, tt.missing)
+			}
+			if got := subsessionIds(changes.ChangedSessions); !reflect.DeepEqual(got, sortedIds(tt.changed)) {
+				t.Errorf("changed sessions: got %v, expected %v", got, tt.changed)
+			}
+			if got := sortedIds(changes.RemovedSessions); !reflect.DeepEqual(got, sortedIds(tt.removed)) {
+				t.Errorf("removed sessions: got %v, expected %v", got, tt.removed)
+			}
+			for _, changed := range changes.ChangedSessions {
+				if !changed.Refresh {
+					t.Errorf("changed session %d without refresh", changed.SubsessionId)
+				}
+			}
+		})
+	}
+}
+
+func TestUpdateEventGroupDates(t *testing.T) {
+	if err := godotenv.Load(); err != nil {
+		t.Skip("Missing .env file with the database configuration")
+	}
+
+	db, err := database.Connect(os.Getenv("DB_USER"), os.Getenv("DB_PASS"), os.Getenv("DB_HOST"), os.Getenv("DB_PORT"), os.Getenv("DB_NAME"), 1, 0)
+	if err != nil {
+		t.Fatalf("database.Connect: %v", err)
+	}
+
+	// The test data is created in a transaction which is rolled back at the end
+	tx := db.Begin()
+	defer tx.Rollback()
+
+	const leagueId, seasonId = 999999001, 999999002
+	launchAt := time.Date(2026, 10, 19, 20, 0, 0, 0, time.UTC)
+
+	competition := events_models.Competition{LeagueID: leagueId, SeasonID: seasonId, Name: "Test", Slug: "test-update-event-group-dates"}
+	groups := []*events_models.EventGroup{
+		{Name: "Scheduled", IRacingTrackId: 1, AutoDates: true, Dates: pq.StringArray{"2026-01-01"}},
+		{Name: "Not scheduled", IRacingTrackId: 2, AutoDates: true, Dates: pq.StringArray{"2026-01-01"}},
+		{Name: "Manual", IRacingTrackId: 1, AutoDates: false, Dates: pq.StringArray{"2026-01-01"}},
+	}
+
+	err = tx.Create(&events_models.LeagueSeason{LeagueID: leagueId, SeasonID: seasonId, League: events_models.League{LeagueID: leagueId}}).Error
+	if err != nil {
+		t.Fatalf("creating the season: %v", err)
+	}
+	if err := tx.Omit("LeagueSeason").Create(&competition).Error; err != nil {
+		t.Fatalf("creating the competition: %v", err)
+	}
+	for _, group := range groups {
+		group.CompetitionID = competition.ID
+		if err := tx.Omit("Competition").Create(group).Error; err != nil {
+			t.Fatalf("creating the event group: %v", err)
+		}
+	}
+
+	err = tx.Create(&[]events_models.LeagueSeasonSession{
+		{LeagueID: leagueId, SeasonID: seasonId, SessionID: 1, TrackID: 1, LaunchAt: launchAt},
+		{LeagueID: leagueId, SeasonID: seasonId, SessionID: 2, TrackID: 1, LaunchAt: launchAt.Add(7 * 24 * time.Hour)},
+		{LeagueID: leagueId, SeasonID: seasonId, SessionID: 3, TrackID: 3, LaunchAt: launchAt},
+	}).Error
+	if err != nil {
+		t.Fatalf("creating the season sessions: %v", err)
+	}
+
+	if err := UpdateEventGroupDates(leagueId, seasonId, tx); err != nil {
+		t.Fatalf("UpdateEventGroupDates: %v", err)
+	}
+
+	expected := map[string]pq.StringArray{
+		"Scheduled":     {"2026-10-19", "2026-10-26"},
+		"Not scheduled": {"2026-01-01"}, // No sessions on its track: the dates are kept
+		"Manual":        {"2026-01-01"},
+	}
+
+	for _, group := range groups {
+		var stored events_models.EventGroup
+		if err := tx.First(&stored, group.ID).Error; err != nil {
+			t.Fatalf("reading the event group: %v", err)
+		}
+
+		if !reflect.DeepEqual(stored.Dates, expected[group.Name]) {
+			t.Errorf("%s: got dates %v, expected %v", group.Name, stored.Dates, expected[group.Name])
+		}
+	}
+}
+
+func subsessionIds(sessions []SessionInfo) []int {
+	ids := make([]int, len(sessions))
+	for i, session := range sessions {
+		ids[i] = session.SubsessionId
+	}
+
+	return sortedIds(ids)
+}
+
+func sortedIds(ids []int) []int {
+	sorted := append([]int{}, ids...)
+	sort.Ints(sorted)
+	return sorted
+}
@@ -1,27 +1,27 @@
 package main
 
 import (
-	"encoding/json"
-	"io"
+	"context"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"time"
 
-	"gorm.io/gorm"
-	"riccardotornesello.it/sharedtelemetry/iracing/cloudrun_utils/handlers"
+	"riccardotornesello.it/sharedtelemetry/iracing/cloudrun_utils/jobs"
 	"riccardotornesello.it/sharedtelemetry/iracing/gorm_utils/database"
 	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue/outbox"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue/transport"
 	"riccardotornesello.it/sharedtelemetry/iracing/sessions_downloader/logic"
 )
 
-var db *gorm.DB
-var irClient *irapi.IRacingApiClient
+const serviceName = "sessions_downloader"
+const relayInterval = 1 * time.Minute
 
 func main() {
-	var err error
-
 	// Get configuration
 	dbUser := os.Getenv("DB_USER")
 	dbPass := os.Getenv("DB_PASS")
@@ -32,82 +32,78 @@ func main() {
 	iRacingEmail := os.Getenv("IRACING_EMAIL")
 	iRacingPassword := os.Getenv("IRACING_PASSWORD")
 
+	skipAi := os.Getenv("SKIP_AI") != "false"
+	skipNoLaps := os.Getenv("SKIP_NO_LAPS") == "true"
+	skipCustIds, err := logic.ParseCustIds(os.Getenv("SKIP_CUST_IDS"))
+	if err != nil {
+		log.Fatalf("logic.ParseCustIds: %v", err)
+	}
+
+	participantsFilter := logic.NewParticipantsFilter(skipAi, skipNoLaps, skipCustIds)
+
+	// The topic is the one of this service, also used to parse the linked subsessions
+	queueDriver := os.Getenv("QUEUE_DRIVER")
+	queueWorkers, _ := strconv.Atoi(os.Getenv("QUEUE_WORKERS"))
+	pubSubProjectId := os.Getenv("PUBSUB_PROJECT")
+	sessionsTopic := transport.SessionsTopic()
+
 	// Initialize database
-	db, err = database.Connect(dbUser, dbPass, dbHost, dbPort, dbName, 20, 2)
+	db, err := database.Connect(dbUser, dbPass, dbHost, dbPort, dbName, 20, 2)
 	if err != nil {
 		log.Fatalf("database.Connect: %v", err)
 	}
 
 	// Initialize iRacing client
-	irClient, err = irapi.NewIRacingApiClient(iRacingEmail, iRacingPassword)
+	irClient, err := irapi.NewIRacingApiClient(iRacingEmail, iRacingPassword)
 	if err != nil {
 		log.Fatalf("irapi.NewIRacingApiClient: %v", err)
 	}
 
-	// Start the HTTP server
-	http.HandleFunc("/", PubSubHandler)
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
-		log.Printf("Defaulting to port %s", port)
+	// Initialize queue
+	queueCtx := context.Background()
+	queueConfig := transport.Config{
+		Driver:          queueDriver,
+		PubSubProjectId: pubSubProjectId,
+		Db:              db,
+		Workers:         queueWorkers,
 	}
 
-	listener, err := net.Listen("tcp4", ":"+port)
+	publisher, err := queueConfig.NewPublisher(queueCtx, sessionsTopic)
 	if err != nil {
-		log.Fatal("Error starting server:", err)
+		log.Fatalf("queueConfig.NewPublisher: %v", err)
 	}
+	defer publisher.Close()
 
-	log.Println("Listening on", listener.Addr())
-	if err := http.Serve(listener, nil); err != nil {
-		log.Fatal(err)
-	}
-}
-
-type PubSubMessage struct {
-	Message struct {
-		Data []byte `json:"data,omitempty"`
-		ID   string `json:"id"`
-	} `json:"message"`
-	Subscription string `json:"subscription"`
-}
+	relay := outbox.NewRelay(db, queue.SessionsTopic, publisher)
+	go relay.Run(queueCtx, relayInterval)
 
-type SessionData struct {
-	SubsessionId int    `json:"subsessionId"`
-	LaunchAt     string `json:"launchAt"`
-}
+	processMessage := logic.NewMessageHandler(irClient, db, 10, participantsFilter, relay)
 
-func PubSubHandler(w http.ResponseWriter, r *http.Request) {
-	body, err := io.ReadAll(r.Body)
-	defer r.Body.Close()
+	err = queueConfig.Consume(queueCtx, http.DefaultServeMux, sessionsTopic, jobs.Handler(db, serviceName, processMessage))
 	if err != nil {
-		handlers.ReturnException(w, err, "io.ReadAll")
-		return
+		log.Fatalf("queueConfig.Consume: %v", err)
 	}
 
-	var m PubSubMessage
-	if err := json.Unmarshal(body, &m); err != nil {
-		handlers.ReturnException(w, err, "json.Unmarshal")
-		return
+	// Start the HTTP server
+	// The failed jobs endpoints are exposed only when protected by the admin token
+	if adminToken := os.Getenv("ADMIN_TOKEN"); adminToken != "" {
+		http.HandleFunc("GET /failed-jobs", jobs.RequireToken(adminToken, jobs.ListFailedHandler(db, serviceName)))
+		http.HandleFunc("POST /failed-jobs/{id}/replay", jobs.RequireToken(adminToken, jobs.ReplayFailedHandler(db, serviceName, processMessage)))
 	}
 
-	var sessionData SessionData
-	if err := json.Unmarshal(m.Message.Data, &sessionData); err != nil {
-		handlers.ReturnException(w, err, "json.Unmarshal")
-		return
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+		log.Printf("Defaulting to port %s", port)
 	}
 
-	launchAt, err := time.Parse(time.RFC3339, sessionData.LaunchAt)
+	listener, err := net.Listen("tcp4", ":"+port)
 	if err != nil {
-		handlers.ReturnException(w, err, "time.Parse")
-		return
+		log.Fatal("Error starting server:", err)
 	}
 
-	if err := logic.ParseSession(irClient, sessionData.SubsessionId, launchAt, db, 10); err != nil {
-		handlers.ReturnException(w, err, "logic.ParseSession")
-		return
+	log.Println("Listening on", listener.Addr())
+	if err := http.Serve(listener, nil); err != nil {
+		log.Fatal(err)
 	}
-
-	w.WriteHeader(http.StatusOK)
-	return
 }
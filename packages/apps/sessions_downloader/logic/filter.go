@@ -0,0 +1,75 @@
+package logic
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ParticipantsFilter defines which participants of a session must not be imported.
+type ParticipantsFilter struct {
+	SkipAi      bool
+	SkipNoLaps  bool
+	SkipCustIds map[int]bool
+}
+
+func NewParticipantsFilter(skipAi bool, skipNoLaps bool, skipCustIds []int) *ParticipantsFilter {
+	filter := &ParticipantsFilter{
+		SkipAi:      skipAi,
+		SkipNoLaps:  skipNoLaps,
+		SkipCustIds: make(map[int]bool),
+	}
+
+	for _, custId := range skipCustIds {
+		filter.SkipCustIds[custId] = true
+	}
+
+	return filter
+}
+
+// IsExcluded returns true if the participant must not be imported.
+func (f *ParticipantsFilter) IsExcluded(custId int, ai bool, lapsComplete int) bool {
+	if f == nil {
+		return false
+	}
+
+	if f.SkipNoLaps && lapsComplete == 0 {
+		return true
+	}
+
+	return f.IsLapExcluded(custId, ai)
+}
+
+// IsLapExcluded returns true if the lap was driven by a participant which must not be imported.
+func (f *ParticipantsFilter) IsLapExcluded(custId int, ai bool) bool {
+	if f == nil {
+		return false
+	}
+
+	if f.SkipAi && ai {
+		return true
+	}
+
+	return f.SkipCustIds[custId]
+}
+
+// ParseCustIds parses a comma separated list of customer IDs.
+func ParseCustIds(value string) ([]int, error) {
+	custIds := make([]int, 0)
+
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		custId, err := strconv.Atoi(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid customer ID %q: %w", part, err)
+		}
+
+		custIds = append(custIds, custId)
+	}
+
+	return custIds, nil
+}
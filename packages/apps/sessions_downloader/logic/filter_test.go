@@ -0,0 +1,71 @@
+package logic
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParticipantsFilter(t *testing.T) {
+	filter := NewParticipantsFilter(true, true, []int{100})
+
+	tests := []struct {
+		name         string
+		filter       *ParticipantsFilter
+		custId       int
+		ai           bool
+		lapsComplete int
+		excluded     bool
+		lapExcluded  bool
+	}{
+		{name: "nil filter", filter: nil, custId: 100, ai: true, excluded: false, lapExcluded: false},
+		{name: "included", filter: filter, custId: 1, lapsComplete: 10, excluded: false, lapExcluded: false},
+		{name: "ai", filter: filter, custId: 1, ai: true, lapsComplete: 10, excluded: true, lapExcluded: true},
+		{name: "no laps", filter: filter, custId: 1, lapsComplete: 0, excluded: true, lapExcluded: false},
+		{name: "skipped customer", filter: filter, custId: 100, lapsComplete: 10, excluded: true, lapExcluded: true},
+		{name: "ai allowed", filter: NewParticipantsFilter(false, false, nil), custId: 1, ai: true, excluded: false, lapExcluded: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.filter.IsExcluded(tt.custId, tt.ai, tt.lapsComplete); got != tt.excluded {
+				t.Errorf("IsExcluded: got %v, expected %v", got, tt.excluded)
+			}
+			if got := tt.filter.IsLapExcluded(tt.custId, tt.ai); got != tt.lapExcluded {
+				t.Errorf("IsLapExcluded: got %v, expected %v", got, tt.lapExcluded)
+			}
+		})
+	}
+}
+
+func TestParseCustIds(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   string
+		want    []int
+		wantErr bool
+	}{
+		{name: "empty", value: "", want: []int{}},
+		{name: "single", value: "123", want: []int{123}},
+		{name: "list with spaces", value: " 123, 456 ,,789 ", want: []int{123, 456, 789}},
+		{name: "invalid", value: "123,abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseCustIds(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %v, expected %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package logic
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/cloudrun_utils/jobs"
+	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue/outbox"
+)
+
+// NewMessageHandler returns the handler of the sessions downloader messages,
+// which parses the session described by the message.
+func NewMessageHandler(irClient *irapi.IRacingApiClient, db *gorm.DB, workers int, filter *ParticipantsFilter, relay *outbox.Relay) queue.Handler {
+	return func(ctx context.Context, data []byte) error {
+		sessionData, err := queue.DecodeJSON[queue.SessionMessage](data)
+		if err != nil {
+			return jobs.Permanent(fmt.Errorf("queue.DecodeJSON: %w", err))
+		}
+
+		launchAt, err := time.Parse(time.RFC3339, sessionData.LaunchAt)
+		if err != nil {
+			return jobs.Permanent(fmt.Errorf("time.Parse: %w", err))
+		}
+
+		err = ParseSession(irClient, sessionData.SubsessionId, launchAt, sessionData.Refresh, db, workers, filter, relay, ctx)
+		if err != nil {
+			if recordErr := RecordSessionFailure(sessionData.SubsessionId, err, db); recordErr != nil {
+				slog.Error(fmt.Sprintf("Error recording the failure of session %d: %v", sessionData.SubsessionId, recordErr))
+			}
+
+			if irapi.IsPermanentError(err) {
+				err = jobs.Permanent(err)
+			}
+			return fmt.Errorf("logic.ParseSession: %w", err)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,104 @@
+package logic
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
+)
+
+var lapColumns = []string{
+	"created_at",
+	"updated_at",
+	"subsession_id",
+	"simsession_number",
+	"cust_id",
+	"lap_events",
+	"incident",
+	"lap_time",
+	"lap_number",
+	"session_time",
+	"session_start_time",
+	"flags",
+	"personal_best_lap",
+	"team_fastest_lap",
+	"car_number",
+}
+
+// lapsCopySource feeds the COPY FROM protocol directly from the workers output,
+// so that the laps of a session are never held in memory all together.
+type lapsCopySource struct {
+	ctx      context.Context
+	lapsChan <-chan *events_models.Lap
+	now      time.Time
+	current  *events_models.Lap
+}
+
+func (s *lapsCopySource) Next() bool {
+	select {
+	case <-s.ctx.Done():
+		return false
+	case lap, ok := <-s.lapsChan:
+		if !ok {
+			return false
+		}
+
+		s.current = lap
+		return true
+	}
+}
+
+func (s *lapsCopySource) Values() ([]any, error) {
+	lap := s.current
+
+	return []any{
+		s.now,
+		s.now,
+		lap.SubsessionID,
+		lap.SimsessionNumber,
+		lap.CustID,
+		[]string(lap.LapEvents),
+		lap.Incident,
+		lap.LapTime,
+		lap.LapNumber,
+		lap.SessionTime,
+		lap.SessionStartTime,
+		lap.Flags,
+		lap.PersonalBestLap,
+		lap.TeamFastestLap,
+		lap.CarNumber,
+	}, nil
+}
+
+func (s *lapsCopySource) Err() error {
+	return context.Cause(s.ctx)
+}
+
+// copyLaps stores the laps received from the channel using COPY FROM.
+// The connection must be the one holding the current transaction, so that the laps
+// are committed or rolled back together with the rest of the session.
+func copyLaps(conn *sql.Conn, ctx context.Context, lapsChan <-chan *events_models.Lap) (int64, error) {
+	var copied int64
+
+	err := conn.Raw(func(driverConn any) error {
+		pgxConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unsupported database driver %T", driverConn)
+		}
+
+		var err error
+		copied, err = pgxConn.Conn().CopyFrom(
+			context.Background(),
+			pgx.Identifier{"laps"},
+			lapColumns,
+			&lapsCopySource{ctx: ctx, lapsChan: lapsChan, now: time.Now()},
+		)
+		return err
+	})
+
+	return copied, err
+}
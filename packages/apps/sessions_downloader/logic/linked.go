@@ -0,0 +1,104 @@
+package logic
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+)
+
+// GetSessionLinks returns the relations between a subsession and the other splits of
+// the same session and its associated subsessions (e.g. heat races).
+func GetSessionLinks(subsessionId int, splitIds []int, associatedIds []int) []events_models.SessionLink {
+	links := make([]events_models.SessionLink, 0)
+	linked := map[int]bool{subsessionId: true}
+
+	for _, ids := range []struct {
+		linkType string
+		ids      []int
+	}{
+		{events_models.SessionLinkTypeSplit, splitIds},
+		{events_models.SessionLinkTypeAssociated, associatedIds},
+	} {
+		for _, id := range ids.ids {
+			if linked[id] {
+				continue
+			}
+			linked[id] = true
+
+			links = append(links, events_models.SessionLink{
+				SubsessionID:       subsessionId,
+				LinkedSubsessionID: id,
+				Type:               ids.linkType,
+			})
+		}
+	}
+
+	return links
+}
+
+// StoreSessionLinks stores the relations of a subsession, creating the linked sessions which
+// are not in the database yet. It returns the IDs of the created sessions, which must be parsed.
+func StoreSessionLinks(links []events_models.SessionLink, db *gorm.DB) ([]int, error) {
+	if len(links) == 0 {
+		return nil, nil
+	}
+
+	linkedIds := make([]int, len(links))
+	for i, link := range links {
+		linkedIds[i] = link.LinkedSubsessionID
+	}
+
+	var storedSessions []events_models.Session
+	if err := db.Where("subsession_id IN ?", linkedIds).Find(&storedSessions).Error; err != nil {
+		return nil, err
+	}
+
+	storedSessionIds := make(map[int]bool)
+	for _, storedSession := range storedSessions {
+		storedSessionIds[storedSession.SubsessionID] = true
+	}
+
+	now := time.Now()
+	missingSessions := make([]events_models.Session, 0)
+	missingSessionIds := make([]int, 0)
+	for _, id := range linkedIds {
+		if !storedSessionIds[id] {
+			missingSessions = append(missingSessions, events_models.Session{SubsessionID: id, QueuedAt: &now})
+			missingSessionIds = append(missingSessionIds, id)
+		}
+	}
+
+	if len(missingSessions) > 0 {
+		if err := db.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "subsession_id"}},
+			DoNothing: true,
+		}).Create(missingSessions).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	if err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "subsession_id"}, {Name: "linked_subsession_id"}},
+		DoNothing: true,
+	}).Create(links).Error; err != nil {
+		return nil, err
+	}
+
+	return missingSessionIds, nil
+}
+
+func SendSessionsToParse(publisher queue.Publisher, ctx context.Context, subsessionIds []int, launchAt time.Time) error {
+	messages := make([]queue.SessionMessage, len(subsessionIds))
+	for i, subsessionId := range subsessionIds {
+		messages[i] = queue.SessionMessage{
+			SubsessionId: subsessionId,
+			LaunchAt:     launchAt.Format(time.RFC3339),
+		}
+	}
+
+	return queue.PublishJSON(ctx, publisher, messages...)
+}
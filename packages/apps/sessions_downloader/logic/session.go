@@ -2,17 +2,24 @@ package logic
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"log/slog"
 	"sync"
 	"time"
 
 	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/cloudrun_utils/jobs"
 	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
 	"riccardotornesello.it/sharedtelemetry/iracing/irapi"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue/outbox"
 )
 
-func ParseSession(irClient *irapi.IRacingApiClient, subsessionId int, subsessionLaunchAt time.Time, db *gorm.DB, workers int) error {
+// ParseSession downloads and stores the results and the laps of a subsession.
+// The launch time is used only if the results don't have the start time of the subsession.
+// If refresh is true, the data of a session already parsed is replaced.
+// If the relay is not nil, the linked subsessions not yet in the database are sent to be parsed.
+func ParseSession(irClient *irapi.IRacingApiClient, subsessionId int, subsessionLaunchAt time.Time, refresh bool, db *gorm.DB, workers int, filter *ParticipantsFilter, relay *outbox.Relay, ctx context.Context) error {
 	// Check the info already in the database
 	var dbSession events_models.Session
 	err := db.Where("subsession_id = ?", subsessionId).First(&dbSession).Error
@@ -20,10 +27,28 @@ func ParseSession(irClient *irapi.IRacingApiClient, subsessionId int, subsession
 		return err
 	}
 
-	// If the session is already parsed, return
+	// If the session is already parsed, return, unless its data must be replaced
 	// TODO: check by parse date
-	if dbSession.TrackID != 0 {
-		slog.Info("Session %d already parsed", subsessionId)
+	if dbSession.TrackID != 0 && !refresh {
+		slog.Info("Session already parsed", "subsessionId", subsessionId)
+		return nil
+	}
+
+	// The session may have been parsed by another execution since the check
+	query := db.Model(&events_models.Session{}).Where("subsession_id = ?", subsessionId)
+	if !refresh {
+		query = query.Where("track_id = 0")
+	}
+
+	result := query.Updates(map[string]any{
+		"status":              events_models.IngestionStatusDownloading,
+		"download_started_at": time.Now(),
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		slog.Info("Session already parsed", "subsessionId", subsessionId)
 		return nil
 	}
 
@@ -33,17 +58,33 @@ func ParseSession(irClient *irapi.IRacingApiClient, subsessionId int, subsession
 		return fmt.Errorf("error getting results for session %d: %w", subsessionId, err)
 	}
 
+	if results.ResultsRestricted {
+		return jobs.Permanent(fmt.Errorf("results of session %d are restricted", subsessionId))
+	}
+
+	// The linked subsessions (e.g. heat races) are sent with the launch time of the subsession
+	// which found them, so their own start time is used when available
+	launchAt := subsessionLaunchAt
+	if startTime, err := time.Parse(time.RFC3339, results.StartTime); err == nil {
+		launchAt = startTime
+	}
+
 	// For each simsession, get the results for each driver
 	// results.SessionResults: one for each simsession (practice, quali...)
 	// results.SessionResults[i].Results: one for each driver
+	// The participants excluded by the filter are neither downloaded nor stored.
 	tasksCount := 0
 	for _, simSessionResult := range results.SessionResults {
-		tasksCount += len(simSessionResult.Results)
+		for _, participant := range simSessionResult.Results {
+			if !filter.IsExcluded(participant.CustId, participant.Ai, participant.LapsComplete) {
+				tasksCount++
+			}
+		}
 	}
 
 	tasksChan := make(chan sessionLapTask, tasksCount)
 	resultsChan := make(chan *events_models.Lap, 0)
-	ctx, cancel := context.WithCancelCause(context.Background())
+	ctx, cancel := context.WithCancelCause(ctx)
 	defer cancel(nil)
 
 	// Start the workers to call the API and generate the lap models
@@ -56,24 +97,17 @@ func ParseSession(irClient *irapi.IRacingApiClient, subsessionId int, subsession
 			ctx,
 			&workersWg,
 			cancel,
+			filter,
 		)
 	}
 
-	// Collect the laps
-	laps := make([]*events_models.Lap, 0)
-
-	var outputWg sync.WaitGroup
-	outputWg.Add(1)
-	go func() {
-		defer outputWg.Done()
-		for lap := range resultsChan {
-			laps = append(laps, lap)
-		}
-	}()
-
 	// Send the tasks to the workers
 	for _, simSessionResult := range results.SessionResults {
 		for _, participant := range simSessionResult.Results {
+			if filter.IsExcluded(participant.CustId, participant.Ai, participant.LapsComplete) {
+				continue
+			}
+
 			tasksChan <- sessionLapTask{
 				subsessionId:     results.SubsessionId,
 				simsessionNumber: simSessionResult.SimsessionNumber,
@@ -83,91 +117,159 @@ func ParseSession(irClient *irapi.IRacingApiClient, subsessionId int, subsession
 	}
 	close(tasksChan) // Signal to workers that no more input will be sent
 
-	// Wait for the workers to finish
-	workersWg.Wait()
-	close(resultsChan) // Signal to the collector that no more output will be sent
-
-	// Wait for the outputs collection to finish
-	outputWg.Wait()
-
-	// In case of error, return it
-	if err = context.Cause(ctx); err != nil {
-		return err
-	}
+	// Signal to the laps writer that no more output will be sent once the workers are done
+	go func() {
+		workersWg.Wait()
+		close(resultsChan)
+	}()
 
-	// DB: create a new transaction
-	tx := db.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+	// DB: use a dedicated connection, as the laps are copied through the driver connection
+	// holding the transaction while the workers are still downloading them
+	err = db.Connection(func(conn *gorm.DB) error {
+		sqlConn, ok := conn.Statement.ConnPool.(*sql.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected connection type %T", conn.Statement.ConnPool)
 		}
-	}()
 
-	// Update the session in the database.
-	// If the session is already parsed, return an error.
-	// TODO: check if the session is already parsed by the launch date.
-	result := tx.Model(&events_models.Session{}).Where("subsession_id = ? AND track_id = 0", subsessionId).Updates(events_models.Session{
-		LeagueID: results.LeagueId,
-		SeasonID: results.SeasonId,
-		LaunchAt: subsessionLaunchAt,
-		TrackID:  results.Track.TrackId,
-	})
-	if result.RowsAffected == 0 {
-		tx.Rollback()
-		return fmt.Errorf("session %d already parsed", subsessionId)
-	}
-	if result.Error != nil {
-		tx.Rollback()
-		return err
-	}
+		// DB: create a new transaction
+		tx := conn.Begin()
+		if tx.Error != nil {
+			return tx.Error
+		}
+		defer func() {
+			if r := recover(); r != nil {
+				tx.Rollback()
+			}
+		}()
 
-	// Store all the simsessions in the database
-	sessions := make([]events_models.SessionSimsession, len(results.SessionResults))
-	for i, result := range results.SessionResults {
-		sessions[i] = events_models.SessionSimsession{
-			SubsessionID:     subsessionId,
-			SimsessionNumber: result.SimsessionNumber,
-			SimsessionType:   result.SimsessionType,
-			SimsessionName:   result.SimsessionName,
+		// Update the session in the database.
+		// If the session is already parsed, return an error.
+		// TODO: check if the session is already parsed by the launch date.
+		query := tx.Model(&events_models.Session{}).Where("subsession_id = ?", subsessionId)
+		if !refresh {
+			query = query.Where("track_id = 0")
 		}
-	}
 
-	if len(sessions) > 0 {
-		if err = tx.Create(sessions).Error; err != nil {
+		result := query.Updates(map[string]any{
+			"league_id": results.LeagueId,
+			"season_id": results.SeasonId,
+			"launch_at": launchAt,
+			"track_id":  results.Track.TrackId,
+			"status":    events_models.IngestionStatusParsed,
+			"parsed_at": time.Now(),
+			"error":     "",
+		})
+		if result.Error != nil {
 			tx.Rollback()
-			return err
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			// Another execution, e.g. a redelivery of the message, parsed the session in the meantime
+			tx.Rollback()
+			slog.Info("Session already parsed by another execution", "subsessionId", subsessionId)
+			return nil
+		}
+
+		// Delete the previous data of the session.
+		// The participants and the laps are deleted by the foreign keys cascade.
+		if refresh {
+			if err := tx.Unscoped().Where("subsession_id = ?", subsessionId).Delete(&events_models.SessionSimsession{}).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
 		}
-	}
 
-	// Store the participants of each simsession in the database
-	participants := make([]events_models.SessionSimsessionParticipant, 0)
-	for _, result := range results.SessionResults {
-		for _, participant := range result.Results {
-			participants = append(participants, events_models.SessionSimsessionParticipant{
+		// Store all the simsessions in the database
+		sessions := make([]events_models.SessionSimsession, len(results.SessionResults))
+		for i, result := range results.SessionResults {
+			sessions[i] = events_models.SessionSimsession{
 				SubsessionID:     subsessionId,
 				SimsessionNumber: result.SimsessionNumber,
-				CustID:           participant.CustId,
-				CarID:            participant.CarId,
-			})
+				SimsessionType:   result.SimsessionType,
+				SimsessionName:   result.SimsessionName,
+			}
+		}
+
+		if len(sessions) > 0 {
+			if err := tx.Create(sessions).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+
+		// Store the participants of each simsession in the database
+		participants := make([]events_models.SessionSimsessionParticipant, 0)
+		for _, result := range results.SessionResults {
+			for _, participant := range result.Results {
+				if filter.IsExcluded(participant.CustId, participant.Ai, participant.LapsComplete) {
+					continue
+				}
+
+				finishPosition := participant.FinishPosition
+				participants = append(participants, events_models.SessionSimsessionParticipant{
+					SubsessionID:     subsessionId,
+					SimsessionNumber: result.SimsessionNumber,
+					CustID:           participant.CustId,
+					CarID:            participant.CarId,
+					FinishPosition:   &finishPosition,
+				})
+			}
+		}
+
+		if len(participants) > 0 {
+			if err := tx.Create(participants).Error; err != nil {
+				tx.Rollback()
+				return err
+			}
 		}
-	}
 
-	if len(participants) > 0 {
-		if err = tx.Create(participants).Error; err != nil {
+		// Store the laps as soon as the workers produce them.
+		// In case of error of a worker, the copy is aborted with the worker's error.
+		lapsCount, err := copyLaps(sqlConn, ctx, resultsChan)
+		if err != nil {
+			cancel(err)
 			tx.Rollback()
 			return err
 		}
+
+		slog.Info("Session laps stored", "subsessionId", subsessionId, "laps", lapsCount)
+
+		// Store the relations with the other splits and the associated subsessions
+		// and store in the outbox the messages to parse the ones not yet in the database
+		if relay != nil {
+			splitIds := make([]int, len(results.SessionSplits))
+			for i, split := range results.SessionSplits {
+				splitIds[i] = split.SubsessionId
+			}
+
+			links := GetSessionLinks(subsessionId, splitIds, results.AssociatedSubsessionIds)
+			newSessionIds, err := StoreSessionLinks(links, tx)
+			if err != nil {
+				tx.Rollback()
+				return err
+			}
+
+			if err := SendSessionsToParse(relay.NewPublisher(tx), ctx, newSessionIds, launchAt); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+
+		return tx.Commit().Error
+	})
+	if err != nil {
+		return err
 	}
 
-	// Store the laps
-	if len(laps) > 0 {
-		if err = tx.Create(laps).Error; err != nil {
-			tx.Rollback()
-			return err
+	// The messages are sent only after the commit. If the relay fails,
+	// the pending messages are sent by the next flush.
+	if relay != nil {
+		if _, err := relay.Flush(ctx); err != nil {
+			slog.Error(fmt.Sprintf("Error sending the linked sessions of session %d: %v", subsessionId, err))
 		}
 	}
 
-	return tx.Commit().Error
+	return nil
 }
 
 type sessionLapTask struct {
@@ -182,6 +284,7 @@ func parseSessionLapsWorker(irClient *irapi.IRacingApiClient,
 	ctx context.Context,
 	wg *sync.WaitGroup,
 	cancel context.CancelCauseFunc,
+	filter *ParticipantsFilter,
 ) {
 	defer wg.Done() // Ensure the wait group counter is decremented when the worker exits
 
@@ -204,7 +307,17 @@ func parseSessionLapsWorker(irClient *irapi.IRacingApiClient,
 			}
 
 			for _, lap := range res.Laps {
-				resultsChan <- &events_models.Lap{
+				// Team sessions can include laps driven by excluded participants
+				if filter.IsLapExcluded(lap.CustId, lap.Ai) {
+					continue
+				}
+
+				select {
+				case <-ctx.Done():
+					// The laps writer or another worker has failed
+					return
+
+				case resultsChan <- &events_models.Lap{
 					SubsessionID:     task.subsessionId,
 					SimsessionNumber: task.simsessionNumber,
 					CustID:           lap.CustId,
@@ -212,8 +325,30 @@ func parseSessionLapsWorker(irClient *irapi.IRacingApiClient,
 					Incident:         lap.Incident,
 					LapTime:          lap.LapTime,
 					LapNumber:        lap.LapNumber,
+					SessionTime:      lap.SessionTime,
+					SessionStartTime: lap.SessionStartTime,
+					Flags:            lap.Flags,
+					PersonalBestLap:  lap.PersonalBestLap,
+					TeamFastestLap:   lap.TeamFastestLap,
+					CarNumber:        lap.CarNumber,
+				}:
 				}
 			}
 		}
 	}
 }
+
+// RecordSessionFailure marks the session as failed with the error of the last attempt.
+// The sessions parsed in the meantime by another execution are not changed.
+func RecordSessionFailure(subsessionId int, parseErr error, db *gorm.DB) error {
+	return db.
+		Model(&events_models.Session{}).
+		Where("subsession_id = ?", subsessionId).
+		Where("status <> ?", events_models.IngestionStatusParsed).
+		Updates(map[string]any{
+			"status":    events_models.IngestionStatusFailed,
+			"failed_at": time.Now(),
+			"error":     parseErr.Error(),
+		}).
+		Error
+}
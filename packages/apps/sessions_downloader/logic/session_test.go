@@ -1,6 +1,7 @@
 package logic
 
 import (
+	"context"
 	"log"
 	"os"
 	"testing"
@@ -35,5 +36,5 @@ func TestParseSession(t *testing.T) {
 		log.Fatalf("database.Connect: %v", err)
 	}
 
-	ParseSession(irClient, 32057183, time.Now(), db, 3)
+	ParseSession(irClient, 32057183, time.Now(), false, db, 3, NewParticipantsFilter(true, true, nil), nil, context.Background())
 }
@@ -0,0 +1,173 @@
+package jobs
+
+import (
+	"crypto/subtle"
+
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/cloudrun_utils/handlers"
+	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+)
+
+// PermanentError marks an error that retrying the job cannot solve,
+// like an invalid payload or a resource which is not accessible.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent marks the error as permanent for the queue consumers (see queue.IsPermanent).
+func (e *PermanentError) Permanent() bool {
+	return true
+}
+
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &PermanentError{Err: err}
+}
+
+// Handler wraps the job processor for a queue consumer.
+// Permanent failures are stored as failed jobs and acknowledged, so that the message
+// is not delivered again. Other failures are returned to the queue to be retried.
+func Handler(db *gorm.DB, service string, process queue.Handler) queue.Handler {
+	return func(ctx context.Context, payload []byte) error {
+		err := process(ctx, payload)
+		if err == nil || !queue.IsPermanent(err) {
+			return err
+		}
+
+		slog.Warn(fmt.Sprintf("%s: permanent failure: %v", service, err))
+
+		failedJob := events_models.FailedJob{
+			Service: service,
+			Payload: payload,
+			Error:   err.Error(),
+		}
+		if storeErr := db.WithContext(ctx).Create(&failedJob).Error; storeErr != nil {
+			return fmt.Errorf("error storing failed job: %w", storeErr)
+		}
+
+		return nil
+	}
+}
+
+type failedJobInfo struct {
+	Id         uint       `json:"id"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	Payload    string     `json:"payload"`
+	Error      string     `json:"error"`
+	ReplayedAt *time.Time `json:"replayedAt"`
+}
+
+func newFailedJobInfo(job *events_models.FailedJob) *failedJobInfo {
+	return &failedJobInfo{
+		Id:         job.ID,
+		CreatedAt:  job.CreatedAt,
+		Payload:    string(job.Payload),
+		Error:      job.Error,
+		ReplayedAt: job.ReplayedAt,
+	}
+}
+
+func writeJson(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// RequireToken allows the requests to the handler only with the header "Authorization: Bearer <token>".
+func RequireToken(token string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		requestToken, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(requestToken), []byte(token)) != 1 {
+			writeJson(w, http.StatusUnauthorized, map[string]string{"error": "Unauthorized"})
+			return
+		}
+
+		next(w, r)
+	}
+}
+
+// ListFailedHandler returns the failed jobs of the service.
+// The replayed jobs are included only with the query parameter all=true.
+func ListFailedHandler(db *gorm.DB, service string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := db.Where("service = ?", service).Order("id")
+		if r.URL.Query().Get("all") != "true" {
+			query = query.Where("replayed_at IS NULL")
+		}
+
+		var failedJobs []*events_models.FailedJob
+		if err := query.Find(&failedJobs).Error; err != nil {
+			handlers.ReturnException(w, err, "db.Find")
+			return
+		}
+
+		response := make([]*failedJobInfo, len(failedJobs))
+		for i, failedJob := range failedJobs {
+			response[i] = newFailedJobInfo(failedJob)
+		}
+
+		writeJson(w, http.StatusOK, response)
+	}
+}
+
+// ReplayFailedHandler executes again the failed job specified by the "id" path value.
+// On success the job is marked as replayed, otherwise its error is updated.
+func ReplayFailedHandler(db *gorm.DB, service string, process queue.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeJson(w, http.StatusBadRequest, map[string]string{"error": "Invalid job ID"})
+			return
+		}
+
+		var failedJob events_models.FailedJob
+		err = db.Where("service = ?", service).Where("id = ?", id).First(&failedJob).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				writeJson(w, http.StatusNotFound, map[string]string{"error": "Job not found"})
+			} else {
+				handlers.ReturnException(w, err, "db.First")
+			}
+			return
+		}
+
+		status := http.StatusOK
+		if err := process(r.Context(), failedJob.Payload); err != nil {
+			slog.Error(fmt.Sprintf("replay of job %d: %v", failedJob.ID, err))
+			failedJob.Error = err.Error()
+			status = http.StatusInternalServerError
+		} else {
+			now := time.Now()
+			failedJob.ReplayedAt = &now
+		}
+
+		if err := db.Save(&failedJob).Error; err != nil {
+			handlers.ReturnException(w, err, "db.Save")
+			return
+		}
+
+		writeJson(w, status, newFailedJobInfo(&failedJob))
+	}
+}
@@ -13,6 +13,11 @@ type Driver struct {
 
 	CustID int `gorm:"primarykey"`
 
-	Name     string
-	Location string
+	Name     string // Searched through the trigram index idx_drivers_name_trgm, created by the migrations
+	Location string `gorm:"index"`
+	ClubName string
+
+	// Set when the driver is not in the stats of any car category anymore
+	// (inactive, banned or closed account), cleared when it's back
+	MissingSince *time.Time `gorm:"index"`
 }
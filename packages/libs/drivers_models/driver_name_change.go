@@ -0,0 +1,14 @@
+package drivers_models
+
+import (
+	"time"
+)
+
+// Change of the name of a driver, detected by the drivers downloader
+type DriverNameChange struct {
+	CustID    int       `gorm:"primaryKey;not null"`
+	ChangedAt time.Time `gorm:"primaryKey;not null;index"`
+
+	PreviousName string `gorm:"not null"`
+	Name         string `gorm:"not null"`
+}
@@ -16,6 +16,21 @@ type DriverStats struct {
 	CustID      int    `gorm:"primaryKey;not null"`
 	CarCategory string `gorm:"primaryKey;not null"`
 
-	License string `gorm:"not null"`
-	IRating int    `gorm:"not null"`
+	License      string `gorm:"not null"` // Class and safety rating, like "A 3.45"
+	LicenseClass string
+	SafetyRating *float64 // Nil if missing
+	IRating      int      `gorm:"not null"`
+	TTRating     int
+
+	Starts            int
+	Wins              int
+	AvgStartPosition  float64
+	AvgFinishPosition float64
+	AvgPoints         float64
+	Top25Percent      int
+	Laps              int
+	LapsLed           int
+	AvgIncidents      float64
+	ClubPoints        int
+	ChampPoints       int
 }
@@ -0,0 +1,19 @@
+package drivers_models
+
+import (
+	"time"
+)
+
+// Snapshot of the stats of a driver in a car category.
+// A new snapshot is stored only when the license or the iRating change,
+// so each one is valid until the following one.
+type DriverStatsHistory struct {
+	CustID      int       `gorm:"primaryKey;not null"`
+	CarCategory string    `gorm:"primaryKey;not null"`
+	RecordedAt  time.Time `gorm:"primaryKey;not null"`
+
+	License      string `gorm:"not null"`
+	LicenseClass string
+	SafetyRating *float64 // Nil if missing
+	IRating      int      `gorm:"not null"`
+}
@@ -0,0 +1,14 @@
+-- Create "driver_stats_histories" table
+CREATE TABLE "public"."driver_stats_histories" (
+  "cust_id" bigint NOT NULL,
+  "car_category" text NOT NULL,
+  "recorded_at" timestamptz NOT NULL,
+  "license" text NOT NULL,
+  "i_rating" bigint NOT NULL,
+  PRIMARY KEY ("cust_id", "car_category", "recorded_at")
+);
+-- Store the current stats as the first snapshots
+INSERT INTO "public"."driver_stats_histories" ("cust_id", "car_category", "recorded_at", "license", "i_rating")
+SELECT "cust_id", "car_category", COALESCE("updated_at", "created_at", now()), "license", "i_rating"
+FROM "public"."driver_stats"
+WHERE "deleted_at" IS NULL;
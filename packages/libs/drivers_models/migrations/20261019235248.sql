@@ -0,0 +1,9 @@
+-- Modify "driver_stats" table
+ALTER TABLE "public"."driver_stats" ADD COLUMN "license_class" text NULL, ADD COLUMN "safety_rating" numeric NULL, ADD COLUMN "tt_rating" bigint NULL, ADD COLUMN "starts" bigint NULL, ADD COLUMN "wins" bigint NULL, ADD COLUMN "avg_start_position" numeric NULL, ADD COLUMN "avg_finish_position" numeric NULL, ADD COLUMN "avg_points" numeric NULL, ADD COLUMN "top25_percent" bigint NULL, ADD COLUMN "laps" bigint NULL, ADD COLUMN "laps_led" bigint NULL, ADD COLUMN "avg_incidents" numeric NULL, ADD COLUMN "club_points" bigint NULL, ADD COLUMN "champ_points" bigint NULL;
+-- Modify "driver_stats_histories" table
+ALTER TABLE "public"."driver_stats_histories" ADD COLUMN "license_class" text NULL, ADD COLUMN "safety_rating" numeric NULL;
+-- Modify "drivers" table
+ALTER TABLE "public"."drivers" ADD COLUMN "club_name" text NULL;
+-- Split the stored licenses in class and safety rating
+UPDATE "public"."driver_stats" SET "license_class" = split_part("license", ' ', 1), "safety_rating" = CAST(NULLIF(split_part("license", ' ', 2), '') AS numeric);
+UPDATE "public"."driver_stats_histories" SET "license_class" = split_part("license", ' ', 1), "safety_rating" = CAST(NULLIF(split_part("license", ' ', 2), '') AS numeric);
@@ -0,0 +1,6 @@
+-- Enable the trigram matching for the drivers search
+CREATE EXTENSION IF NOT EXISTS "pg_trgm";
+-- Create index "idx_drivers_name_trgm" to table: "drivers"
+CREATE INDEX "idx_drivers_name_trgm" ON "public"."drivers" USING gin (lower("name") gin_trgm_ops);
+-- Create index "idx_drivers_location" to table: "drivers"
+CREATE INDEX "idx_drivers_location" ON "public"."drivers" ("location");
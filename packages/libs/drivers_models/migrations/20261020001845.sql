@@ -0,0 +1,14 @@
+-- Modify "drivers" table
+ALTER TABLE "public"."drivers" ADD COLUMN "missing_since" timestamptz NULL;
+-- Create index "idx_drivers_missing_since" to table: "drivers"
+CREATE INDEX "idx_drivers_missing_since" ON "public"."drivers" ("missing_since");
+-- Create "driver_name_changes" table
+CREATE TABLE "public"."driver_name_changes" (
+  "cust_id" bigint NOT NULL,
+  "changed_at" timestamptz NOT NULL,
+  "previous_name" text NOT NULL,
+  "name" text NOT NULL,
+  PRIMARY KEY ("cust_id", "changed_at")
+);
+-- Create index "idx_driver_name_changes_changed_at" to table: "driver_name_changes"
+CREATE INDEX "idx_driver_name_changes_changed_at" ON "public"."driver_name_changes" ("changed_at");
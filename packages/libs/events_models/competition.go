@@ -3,6 +3,7 @@ package events_models
 import (
 	"time"
 
+	"github.com/lib/pq"
 	"gorm.io/gorm"
 )
 
@@ -20,4 +21,20 @@ type Competition struct {
 	Name             string `gorm:"not null"`
 	Slug             string `gorm:"not null;unique"`
 	CrewDriversCount int    `gorm:"not null;default:1"`
+	CarCategory      string `gorm:"not null;default:sports_car"` // Category of the drivers stats (iRating and license) shown in the ranking
+
+	QualifyingRules QualifyingRules `gorm:"embedded;embeddedPrefix:qualifying_"`
+}
+
+// Rules to compute the result of a driver in a session
+type QualifyingRules struct {
+	Laps             int            `gorm:"not null;default:3"`
+	Mode             string         `gorm:"not null;default:consecutive"` // consecutive, best, best_lap, rolling, stints, total or position
+	DisallowedEvents pq.StringArray `gorm:"type:text[]"`                  // Events which invalidate a lap, the default ones if empty
+	AllowedEvents    pq.StringArray `gorm:"type:text[]"`                  // Events removed from the disallowed ones
+	AllowIncidents   bool           `gorm:"not null;default:false"`
+	RestartAfterPit  bool           `gorm:"not null;default:false"` // A pit stop starts a new attempt instead of ending the stint
+	SkipOutLap       bool           `gorm:"not null;default:false"` // Lap 0 is ignored instead of ending the stint
+	Resolution       int            `gorm:"not null;default:1"`     // Resolution of the times in milliseconds
+	RoundTimes       bool           `gorm:"not null;default:false"` // Round the times to the resolution instead of truncating them
 }
@@ -20,4 +20,9 @@ type EventGroup struct {
 	Name           string         `gorm:"not null"`
 	IRacingTrackId int            `gorm:"not null"`
 	Dates          pq.StringArray `gorm:"type:text[]"`
+	AutoDates      bool           `gorm:"not null;default:false"` // Derive the dates from the season's schedule
+
+	// Override the mode and the number of laps of the competition's qualifying rules, if set
+	QualifyingMode string
+	QualifyingLaps int
 }
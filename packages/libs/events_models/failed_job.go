@@ -0,0 +1,23 @@
+package events_models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// A queued job which failed permanently and was removed from the queue.
+// It can be inspected and replayed once the cause is fixed.
+type FailedJob struct {
+	ID uint `gorm:"primarykey"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	Service string `gorm:"not null;index"`
+	Payload []byte `gorm:"not null"`
+	Error   string `gorm:"not null"`
+
+	ReplayedAt *time.Time
+}
@@ -18,4 +18,12 @@ type Lap struct {
 	Incident  bool
 	LapTime   int
 	LapNumber int
+
+	// Times are in ten-thousandths of a second, like the lap time
+	SessionTime      int // Time elapsed since the start of the simsession when the lap was completed
+	SessionStartTime int // Time elapsed since the start of the simsession when the lap was started
+	Flags            int
+	PersonalBestLap  bool
+	TeamFastestLap   bool
+	CarNumber        string
 }
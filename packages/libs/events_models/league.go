@@ -14,5 +14,17 @@ type League struct {
 	DeletedAt gorm.DeletedAt `gorm:"index"`
 
 	LeagueID int `gorm:"primarykey"`
-	// TODO: name
+
+	Name             string
+	OwnerCustID      int
+	OwnerName        string
+	About            string
+	URL              string
+	SmallLogo        string
+	LargeLogo        string
+	RosterCount      int
+	Rules            string
+	MetadataSyncedAt *time.Time // Last sync of the metadata from iRacing
+
+	SeasonsDiscoveredAt *time.Time // Last discovery of the league seasons from iRacing
 }
@@ -16,4 +16,18 @@ type LeagueSeason struct {
 	SeasonID int `gorm:"primarykey"`
 
 	League League `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+
+	Name             string
+	Active           bool `gorm:"not null;default:false"`
+	Hidden           bool `gorm:"not null;default:false"`
+	PointsSystemID   int
+	PointsSystemName string
+
+	SyncStatus    string // Empty if the season was never sent to be synced
+	SyncQueuedAt  *time.Time
+	SyncStartedAt *time.Time
+	LastSyncAt    *time.Time
+	LastSyncError string     // Empty if the last sync succeeded
+	SyncFailures  int        `gorm:"not null;default:0"` // Consecutive failed syncs
+	NextSyncAt    *time.Time `gorm:"index"`              // When the season must be synced again, nil as soon as possible
 }
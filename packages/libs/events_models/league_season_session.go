@@ -0,0 +1,38 @@
+package events_models
+
+import (
+	"time"
+
+	"github.com/lib/pq"
+	"gorm.io/gorm"
+)
+
+// A session of an iRacing's league season, as listed by the season's schedule, including the future ones.
+// It is used to serve the season calendar and to detect the sessions whose status or results changed since the last sync.
+type LeagueSeasonSession struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	LeagueID  int `gorm:"primarykey"`
+	SeasonID  int `gorm:"primarykey"`
+	SessionID int `gorm:"primarykey"`
+
+	SubsessionID   int `gorm:"index"`
+	Status         int
+	HasResults     bool
+	EntryCount     int
+	TeamEntryCount int
+	LaunchAt       time.Time
+
+	TrackID           int
+	TrackName         string
+	TrackConfigName   string
+	CarIDs            pq.Int64Array `gorm:"type:bigint[]"`
+	PracticeLength    int
+	QualifyLength     int
+	QualifyLaps       int
+	RaceLength        int
+	RaceLaps          int
+	PasswordProtected bool
+}
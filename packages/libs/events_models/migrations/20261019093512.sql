@@ -0,0 +1,2 @@
+-- Modify "laps" table
+ALTER TABLE "public"."laps" ADD COLUMN "session_time" bigint NULL, ADD COLUMN "session_start_time" bigint NULL, ADD COLUMN "flags" bigint NULL, ADD COLUMN "personal_best_lap" boolean NULL, ADD COLUMN "team_fastest_lap" boolean NULL, ADD COLUMN "car_number" text NULL;
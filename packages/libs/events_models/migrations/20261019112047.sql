@@ -0,0 +1,14 @@
+-- Create "session_links" table
+CREATE TABLE "public"."session_links" (
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "subsession_id" bigint NOT NULL,
+  "linked_subsession_id" bigint NOT NULL,
+  "type" text NOT NULL,
+  PRIMARY KEY ("subsession_id", "linked_subsession_id"),
+  CONSTRAINT "fk_session_links_linked_session" FOREIGN KEY ("linked_subsession_id") REFERENCES "public"."sessions" ("subsession_id") ON UPDATE CASCADE ON DELETE CASCADE,
+  CONSTRAINT "fk_session_links_session" FOREIGN KEY ("subsession_id") REFERENCES "public"."sessions" ("subsession_id") ON UPDATE CASCADE ON DELETE CASCADE
+);
+-- Create index "idx_session_links_deleted_at" to table: "session_links"
+CREATE INDEX "idx_session_links_deleted_at" ON "public"."session_links" ("deleted_at");
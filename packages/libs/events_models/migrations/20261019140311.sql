@@ -0,0 +1,16 @@
+-- Create "failed_jobs" table
+CREATE TABLE "public"."failed_jobs" (
+  "id" bigserial NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "service" text NOT NULL,
+  "payload" bytea NOT NULL,
+  "error" text NOT NULL,
+  "replayed_at" timestamptz NULL,
+  PRIMARY KEY ("id")
+);
+-- Create index "idx_failed_jobs_deleted_at" to table: "failed_jobs"
+CREATE INDEX "idx_failed_jobs_deleted_at" ON "public"."failed_jobs" ("deleted_at");
+-- Create index "idx_failed_jobs_service" to table: "failed_jobs"
+CREATE INDEX "idx_failed_jobs_service" ON "public"."failed_jobs" ("service");
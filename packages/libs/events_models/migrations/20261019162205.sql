@@ -0,0 +1,15 @@
+-- Create "queue_messages" table
+CREATE TABLE "public"."queue_messages" (
+  "id" bigserial NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "topic" text NOT NULL,
+  "data" bytea NOT NULL,
+  "attempts" bigint NOT NULL DEFAULT 0,
+  "available_at" timestamptz NOT NULL,
+  "dead_at" timestamptz NULL,
+  "error" text NULL,
+  PRIMARY KEY ("id")
+);
+-- Create index "idx_queue_messages_topic_available_at" to table: "queue_messages"
+CREATE INDEX "idx_queue_messages_topic_available_at" ON "public"."queue_messages" ("topic", "available_at");
@@ -0,0 +1,11 @@
+-- Create "outbox_messages" table
+CREATE TABLE "public"."outbox_messages" (
+  "id" bigserial NOT NULL,
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "topic" text NOT NULL,
+  "data" bytea NOT NULL,
+  PRIMARY KEY ("id")
+);
+-- Create index "idx_outbox_messages_topic" to table: "outbox_messages"
+CREATE INDEX "idx_outbox_messages_topic" ON "public"."outbox_messages" ("topic");
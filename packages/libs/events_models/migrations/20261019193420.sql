@@ -0,0 +1,20 @@
+-- Create "league_season_sessions" table
+CREATE TABLE "public"."league_season_sessions" (
+  "created_at" timestamptz NULL,
+  "updated_at" timestamptz NULL,
+  "deleted_at" timestamptz NULL,
+  "league_id" bigint NOT NULL,
+  "season_id" bigint NOT NULL,
+  "session_id" bigint NOT NULL,
+  "subsession_id" bigint NULL,
+  "status" bigint NULL,
+  "has_results" boolean NULL,
+  "entry_count" bigint NULL,
+  "team_entry_count" bigint NULL,
+  "launch_at" timestamptz NULL,
+  PRIMARY KEY ("league_id", "season_id", "session_id")
+);
+-- Create index "idx_league_season_sessions_deleted_at" to table: "league_season_sessions"
+CREATE INDEX "idx_league_season_sessions_deleted_at" ON "public"."league_season_sessions" ("deleted_at");
+-- Create index "idx_league_season_sessions_subsession_id" to table: "league_season_sessions"
+CREATE INDEX "idx_league_season_sessions_subsession_id" ON "public"."league_season_sessions" ("subsession_id");
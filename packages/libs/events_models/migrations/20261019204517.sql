@@ -0,0 +1,4 @@
+-- Modify "event_groups" table
+ALTER TABLE "public"."event_groups" ADD COLUMN "auto_dates" boolean NOT NULL DEFAULT false;
+-- Modify "league_season_sessions" table
+ALTER TABLE "public"."league_season_sessions" ADD COLUMN "track_id" bigint NULL, ADD COLUMN "track_name" text NULL, ADD COLUMN "track_config_name" text NULL, ADD COLUMN "car_ids" bigint[] NULL, ADD COLUMN "practice_length" bigint NULL, ADD COLUMN "qualify_length" bigint NULL, ADD COLUMN "qualify_laps" bigint NULL, ADD COLUMN "race_length" bigint NULL, ADD COLUMN "race_laps" bigint NULL, ADD COLUMN "password_protected" boolean NULL;
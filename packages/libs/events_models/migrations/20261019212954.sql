@@ -0,0 +1,6 @@
+-- Modify "league_seasons" table
+ALTER TABLE "public"."league_seasons" ADD COLUMN "name" text NULL, ADD COLUMN "active" boolean NOT NULL DEFAULT false, ADD COLUMN "hidden" boolean NOT NULL DEFAULT false, ADD COLUMN "points_system_id" bigint NULL, ADD COLUMN "points_system_name" text NULL;
+-- Modify "leagues" table
+ALTER TABLE "public"."leagues" ADD COLUMN "seasons_discovered_at" timestamptz NULL;
+-- Keep syncing the seasons inserted by hand until their first discovery
+UPDATE "public"."league_seasons" SET "active" = true;
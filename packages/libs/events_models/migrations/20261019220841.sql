@@ -0,0 +1,2 @@
+-- Modify "leagues" table
+ALTER TABLE "public"."leagues" ADD COLUMN "name" text NULL, ADD COLUMN "owner_cust_id" bigint NULL, ADD COLUMN "owner_name" text NULL, ADD COLUMN "about" text NULL, ADD COLUMN "url" text NULL, ADD COLUMN "small_logo" text NULL, ADD COLUMN "large_logo" text NULL, ADD COLUMN "roster_count" bigint NULL, ADD COLUMN "rules" text NULL, ADD COLUMN "metadata_synced_at" timestamptz NULL;
@@ -0,0 +1,4 @@
+-- Modify "league_seasons" table
+ALTER TABLE "public"."league_seasons" ADD COLUMN "last_sync_at" timestamptz NULL, ADD COLUMN "last_sync_error" text NULL, ADD COLUMN "sync_failures" bigint NOT NULL DEFAULT 0, ADD COLUMN "next_sync_at" timestamptz NULL;
+-- Create index "idx_league_seasons_next_sync_at" to table: "league_seasons"
+CREATE INDEX "idx_league_seasons_next_sync_at" ON "public"."league_seasons" ("next_sync_at");
@@ -0,0 +1,11 @@
+-- Modify "sessions" table
+ALTER TABLE "public"."sessions" ADD COLUMN "status" text NOT NULL DEFAULT 'queued', ADD COLUMN "queued_at" timestamptz NULL, ADD COLUMN "download_started_at" timestamptz NULL, ADD COLUMN "parsed_at" timestamptz NULL, ADD COLUMN "failed_at" timestamptz NULL, ADD COLUMN "error" text NULL;
+-- Create index "idx_sessions_status" to table: "sessions"
+CREATE INDEX "idx_sessions_status" ON "public"."sessions" ("status");
+-- Set the status of the existing sessions
+UPDATE "public"."sessions" SET "status" = 'parsed', "parsed_at" = "updated_at" WHERE "track_id" <> 0;
+UPDATE "public"."sessions" SET "queued_at" = "created_at" WHERE "track_id" = 0;
+-- Modify "league_seasons" table
+ALTER TABLE "public"."league_seasons" ADD COLUMN "sync_status" text NULL, ADD COLUMN "sync_queued_at" timestamptz NULL, ADD COLUMN "sync_started_at" timestamptz NULL;
+-- Set the status of the synced seasons
+UPDATE "public"."league_seasons" SET "sync_status" = CASE WHEN "last_sync_error" <> '' THEN 'failed' ELSE 'parsed' END WHERE "last_sync_at" IS NOT NULL;
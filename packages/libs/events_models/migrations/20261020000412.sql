@@ -0,0 +1,2 @@
+-- Modify "competitions" table
+ALTER TABLE "public"."competitions" ADD COLUMN "car_category" text NOT NULL DEFAULT 'sports_car';
@@ -0,0 +1,2 @@
+-- Modify "competitions" table
+ALTER TABLE "public"."competitions" ADD COLUMN "qualifying_laps" bigint NOT NULL DEFAULT 3, ADD COLUMN "qualifying_mode" text NOT NULL DEFAULT 'consecutive', ADD COLUMN "qualifying_disallowed_events" text[] NULL, ADD COLUMN "qualifying_allowed_events" text[] NULL, ADD COLUMN "qualifying_allow_incidents" boolean NOT NULL DEFAULT false, ADD COLUMN "qualifying_restart_after_pit" boolean NOT NULL DEFAULT false, ADD COLUMN "qualifying_skip_out_lap" boolean NOT NULL DEFAULT false, ADD COLUMN "qualifying_resolution" bigint NOT NULL DEFAULT 1, ADD COLUMN "qualifying_round_times" boolean NOT NULL DEFAULT false;
@@ -0,0 +1,4 @@
+-- Modify "event_groups" table
+ALTER TABLE "public"."event_groups" ADD COLUMN "qualifying_mode" text NULL, ADD COLUMN "qualifying_laps" bigint NULL;
+-- Modify "session_simsession_participants" table
+ALTER TABLE "public"."session_simsession_participants" ADD COLUMN "finish_position" bigint NULL;
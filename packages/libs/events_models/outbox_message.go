@@ -0,0 +1,17 @@
+package events_models
+
+import (
+	"time"
+)
+
+// A message written in the same transaction of the data it refers to,
+// then sent to the queue and deleted by the outbox relay.
+type OutboxMessage struct {
+	ID uint `gorm:"primarykey"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Topic string `gorm:"not null;index"`
+	Data  []byte `gorm:"not null"`
+}
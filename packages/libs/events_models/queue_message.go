@@ -0,0 +1,23 @@
+package events_models
+
+import (
+	"time"
+)
+
+// A message of the Postgres job queue, which can be used in place of Pub/Sub.
+// While a message is processed, AvailableAt is moved forward as a lease.
+// The messages which fail permanently or too many times are kept as dead letters.
+type QueueMessage struct {
+	ID uint `gorm:"primarykey"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+
+	Topic       string    `gorm:"not null;index:idx_queue_messages_topic_available_at,priority:1"`
+	Data        []byte    `gorm:"not null"`
+	Attempts    int       `gorm:"not null;default:0"`
+	AvailableAt time.Time `gorm:"not null;index:idx_queue_messages_topic_available_at,priority:2"`
+
+	DeadAt *time.Time // Set when the message is no longer delivered
+	Error  string     // Error of the last failed attempt
+}
@@ -6,6 +6,14 @@ import (
 	"gorm.io/gorm"
 )
 
+// Ingestion status of the subsessions and of the syncs of the league seasons.
+const (
+	IngestionStatusQueued      = "queued"      // Sent to be processed
+	IngestionStatusDownloading = "downloading" // Being downloaded from iRacing
+	IngestionStatusParsed      = "parsed"      // Stored successfully
+	IngestionStatusFailed      = "failed"      // The last attempt failed, it may be retried
+)
+
 // iRacing's session/subsession.
 type Session struct {
 	CreatedAt time.Time
@@ -19,4 +27,11 @@ type Session struct {
 
 	LaunchAt time.Time `gorm:"index"`
 	TrackID  int
+
+	Status            string `gorm:"not null;default:queued;index"`
+	QueuedAt          *time.Time
+	DownloadStartedAt *time.Time
+	ParsedAt          *time.Time
+	FailedAt          *time.Time
+	Error             string // Error of the last failed attempt
 }
@@ -0,0 +1,27 @@
+package events_models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	SessionLinkTypeSplit      = "split"      // Another split of the same iRacing session
+	SessionLinkTypeAssociated = "associated" // An associated subsession, like the heats of an event
+)
+
+// Relation between two iRacing subsessions.
+type SessionLink struct {
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	SubsessionID       int `gorm:"primaryKey;not null"`
+	LinkedSubsessionID int `gorm:"primaryKey;not null"`
+
+	Session       Session `gorm:"foreignKey:SubsessionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+	LinkedSession Session `gorm:"foreignKey:LinkedSubsessionID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
+
+	Type string `gorm:"not null"`
+}
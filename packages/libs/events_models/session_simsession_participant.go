@@ -18,5 +18,6 @@ type SessionSimsessionParticipant struct {
 
 	SessionSimsession SessionSimsession `gorm:"foreignKey:SubsessionID,SimsessionNumber;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 
-	CarID int
+	CarID          int
+	FinishPosition *int // Starting from 0, missing in the sessions downloaded before it was stored
 }
@@ -120,7 +120,7 @@ func (c *IRacingApiClient) get(path string) (io.ReadCloser, error) {
 	}
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("error getting %s: %s", path, resp.Status)
+		return nil, &ApiError{Path: path, StatusCode: resp.StatusCode, Status: resp.Status}
 	}
 
 	defer resp.Body.Close()
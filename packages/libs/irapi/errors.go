@@ -0,0 +1,34 @@
+package irapi
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ApiError is returned when the iRacing API answers with an unexpected status code.
+type ApiError struct {
+	Path       string
+	StatusCode int
+	Status     string
+}
+
+func (e *ApiError) Error() string {
+	return fmt.Sprintf("error getting %s: %s", e.Path, e.Status)
+}
+
+// IsPermanentError returns true if the request failed for a reason that retrying
+// it cannot solve, like a missing or private resource.
+func IsPermanentError(err error) bool {
+	var apiErr *ApiError
+	if !errors.As(err, &apiErr) {
+		return false
+	}
+
+	switch apiErr.StatusCode {
+	case http.StatusUnauthorized, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+
+	return apiErr.StatusCode >= 400 && apiErr.StatusCode < 500
+}
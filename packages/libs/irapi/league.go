@@ -13,6 +13,7 @@ type leagueGetResponse struct {
 	Hidden          bool   `json:"hidden"`
 	Message         string `json:"message"`
 	About           string `json:"about"`
+	Rules           string `json:"rules"`
 	Url             string `json:"url"`
 	Recruiting      bool   `json:"recruiting"`
 	PrivateWall     bool   `json:"private_wall"`
@@ -0,0 +1,134 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+)
+
+type message struct {
+	data     []byte
+	attempts int
+}
+
+// Topic is an in-process queue, both publisher and consumer of its messages.
+// The queue is unbounded, so that a handler can publish to its own topic.
+type Topic struct {
+	mu          sync.Mutex
+	messages    []*message
+	processing  int
+	completed   int
+	dropped     int
+	maxAttempts int
+	notify      chan struct{}
+}
+
+// NewTopic creates an in-memory topic. The messages whose handler fails are
+// delivered again until maxAttempts is reached, then they are dropped.
+func NewTopic(maxAttempts int) *Topic {
+	return &Topic{
+		maxAttempts: maxAttempts,
+		notify:      make(chan struct{}, 1),
+	}
+}
+
+func (t *Topic) signal() {
+	select {
+	case t.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (t *Topic) Publish(ctx context.Context, data ...[]byte) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for _, messageData := range data {
+		t.messages = append(t.messages, &message{data: messageData})
+	}
+
+	t.signal()
+
+	return nil
+}
+
+func (t *Topic) Close() error {
+	return nil
+}
+
+// Consume processes the messages one at a time.
+// Multiple goroutines can consume the same topic concurrently.
+func (t *Topic) Consume(ctx context.Context, handler queue.Handler) error {
+	for {
+		t.mu.Lock()
+		if len(t.messages) == 0 {
+			t.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-t.notify:
+				continue
+			}
+		}
+
+		msg := t.messages[0]
+		t.messages = t.messages[1:]
+		t.processing++
+		if len(t.messages) > 0 {
+			// Wake up another consumer for the remaining messages
+			t.signal()
+		}
+		t.mu.Unlock()
+
+		err := handler(ctx, msg.data)
+
+		t.mu.Lock()
+		t.processing--
+		if err == nil {
+			t.completed++
+		} else {
+			msg.attempts++
+			if msg.attempts < t.maxAttempts {
+				slog.Error(fmt.Sprintf("message failed, attempt %d of %d: %v", msg.attempts, t.maxAttempts, err))
+				t.messages = append(t.messages, msg)
+				t.signal()
+			} else {
+				slog.Error(fmt.Sprintf("message dropped after %d attempts: %v", msg.attempts, err))
+				t.dropped++
+			}
+		}
+		t.mu.Unlock()
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+}
+
+// Pending returns the number of messages queued or being processed.
+func (t *Topic) Pending() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return len(t.messages) + t.processing
+}
+
+// Completed returns the number of messages processed successfully.
+func (t *Topic) Completed() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.completed
+}
+
+// Dropped returns the number of messages dropped after reaching the maximum attempts.
+func (t *Topic) Dropped() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	return t.dropped
+}
@@ -0,0 +1,62 @@
+package memory
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTopic(t *testing.T) {
+	topic := NewTopic(2)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	received := make(map[string]int)
+	done := make(chan struct{})
+
+	go topic.Consume(ctx, func(ctx context.Context, data []byte) error {
+		received[string(data)]++
+
+		if string(data) == "retry" && received["retry"] == 1 {
+			return errors.New("first attempt fails")
+		}
+		if string(data) == "fail" {
+			return errors.New("always fails")
+		}
+		if string(data) == "publish" {
+			return topic.Publish(ctx, []byte("published"))
+		}
+		if string(data) == "published" {
+			close(done)
+		}
+
+		return nil
+	})
+
+	topic.Publish(ctx, []byte("retry"), []byte("fail"), []byte("publish"))
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("timeout waiting for the messages")
+	}
+
+	for topic.Pending() > 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	expected := map[string]int{"retry": 2, "fail": 2, "publish": 1, "published": 1}
+	for data, count := range expected {
+		if received[data] != count {
+			t.Errorf("message %q received %d times, expected %d", data, received[data], count)
+		}
+	}
+
+	if topic.Completed() != 3 {
+		t.Errorf("%d messages completed, expected 3", topic.Completed())
+	}
+	if topic.Dropped() != 1 {
+		t.Errorf("%d messages dropped, expected 1", topic.Dropped())
+	}
+}
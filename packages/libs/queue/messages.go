@@ -0,0 +1,20 @@
+package queue
+
+// Default topics of the pipeline
+const (
+	SeasonsTopic  = "seasons"  // Consumed by the season parser
+	SessionsTopic = "sessions" // Consumed by the sessions downloader
+)
+
+// SeasonMessage requests the parsing of an iRacing league season.
+type SeasonMessage struct {
+	LeagueId int `json:"leagueId"`
+	SeasonId int `json:"seasonId"`
+}
+
+// SessionMessage requests the download of an iRacing subsession.
+type SessionMessage struct {
+	SubsessionId int    `json:"subsessionId"`
+	LaunchAt     string `json:"launchAt"`          // RFC3339
+	Refresh      bool   `json:"refresh,omitempty"` // Replace the data of an already parsed subsession
+}
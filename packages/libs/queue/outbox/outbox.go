@@ -0,0 +1,164 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+)
+
+const batchSize = 100
+
+// Publisher stores the messages of a topic in the outbox_messages table.
+// It must be created with the transaction which stores the data the messages refer to,
+// so that the messages exist if and only if the transaction is committed.
+type Publisher struct {
+	tx    *gorm.DB
+	topic string
+}
+
+func NewPublisher(tx *gorm.DB, topic string) *Publisher {
+	return &Publisher{tx: tx, topic: topic}
+}
+
+func (p *Publisher) Publish(ctx context.Context, data ...[]byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	messages := make([]events_models.OutboxMessage, len(data))
+	for i, messageData := range data {
+		messages[i] = events_models.OutboxMessage{
+			Topic: p.topic,
+			Data:  messageData,
+		}
+	}
+
+	return p.tx.WithContext(ctx).Create(messages).Error
+}
+
+func (p *Publisher) Close() error {
+	return nil
+}
+
+// Relay sends the pending messages of a topic from the outbox to the queue.
+// The messages are locked with SELECT ... FOR UPDATE SKIP LOCKED, so that concurrent relays
+// don't send the same messages, and deleted once sent in the same transaction.
+// The delivery is at-least-once: if the transaction fails after the publish, the messages
+// are sent again by the next flush, so the consumers must be idempotent.
+type Relay struct {
+	db        *gorm.DB
+	topic     string
+	publisher queue.Publisher
+}
+
+func NewRelay(db *gorm.DB, topic string, publisher queue.Publisher) *Relay {
+	return &Relay{db: db, topic: topic, publisher: publisher}
+}
+
+// NewPublisher returns a publisher which stores the messages of the relay topic
+// in the outbox, within the transaction.
+func (r *Relay) NewPublisher(tx *gorm.DB) *Publisher {
+	return NewPublisher(tx, r.topic)
+}
+
+// Topic returns the outbox topic of the relay.
+func (r *Relay) Topic() string {
+	return r.topic
+}
+
+// Pending returns the number of messages of the topic not yet sent.
+func (r *Relay) Pending(ctx context.Context) (int64, error) {
+	var count int64
+	err := r.db.WithContext(ctx).Model(&events_models.OutboxMessage{}).Where("topic = ?", r.topic).Count(&count).Error
+	return count, err
+}
+
+// Flush sends all the pending messages and returns the number of sent messages.
+func (r *Relay) Flush(ctx context.Context) (int, error) {
+	total := 0
+
+	for {
+		sent, err := r.flushBatch(ctx)
+		total += sent
+		if err != nil || sent < batchSize {
+			return total, err
+		}
+	}
+}
+
+func (r *Relay) flushBatch(ctx context.Context) (int, error) {
+	tx := r.db.WithContext(ctx).Begin()
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+		}
+	}()
+
+	var messages []events_models.OutboxMessage
+	err := tx.
+		Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Where("topic = ?", r.topic).
+		Order("id").
+		Limit(batchSize).
+		Find(&messages).Error
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if len(messages) == 0 {
+		return 0, tx.Commit().Error
+	}
+
+	ids := make([]uint, len(messages))
+	data := make([][]byte, len(messages))
+	for i, message := range messages {
+		ids[i] = message.ID
+		data[i] = message.Data
+	}
+
+	if err := r.publisher.Publish(ctx, data...); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	err = tx.Where("id IN ?", ids).Delete(&events_models.OutboxMessage{}).Error
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit().Error; err != nil {
+		return 0, err
+	}
+
+	return len(messages), nil
+}
+
+// Run flushes the outbox periodically until the context is canceled.
+// It sends the messages left pending when a flush after the commit failed.
+func (r *Relay) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		sent, err := r.Flush(ctx)
+		if err != nil {
+			slog.Error(fmt.Sprintf("outbox %s: %v", r.topic, err))
+		} else if sent > 0 {
+			slog.Info(fmt.Sprintf("outbox %s: %d pending messages sent", r.topic, sent))
+		}
+	}
+}
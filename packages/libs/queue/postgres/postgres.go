@@ -0,0 +1,192 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"riccardotornesello.it/sharedtelemetry/iracing/events_models"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+)
+
+const (
+	pollInterval = 1 * time.Second
+	maxBackoff   = 10 * time.Minute
+
+	// The time a message is reserved to a worker. If the worker doesn't complete it in time,
+	// e.g. because the instance stopped, the message is delivered again.
+	leaseDuration = 30 * time.Minute
+
+	// The deliveries after which a failing message becomes a dead letter
+	maxAttempts = 10
+)
+
+// Publisher stores the messages of a topic in the queue_messages table.
+type Publisher struct {
+	db    *gorm.DB
+	topic string
+}
+
+func NewPublisher(db *gorm.DB, topic string) *Publisher {
+	return &Publisher{db: db, topic: topic}
+}
+
+func (p *Publisher) Publish(ctx context.Context, data ...[]byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+
+	now := time.Now()
+	messages := make([]events_models.QueueMessage, len(data))
+	for i, messageData := range data {
+		messages[i] = events_models.QueueMessage{
+			Topic:       p.topic,
+			Data:        messageData,
+			AvailableAt: now,
+		}
+	}
+
+	return p.db.WithContext(ctx).Create(messages).Error
+}
+
+func (p *Publisher) Close() error {
+	return nil
+}
+
+// Consumer processes the messages of a topic stored in the queue_messages table.
+// Each message is leased with SELECT ... FOR UPDATE SKIP LOCKED before it is processed,
+// so that multiple workers and instances can consume the same topic.
+// The messages which fail permanently or maxAttempts times are kept as dead letters.
+type Consumer struct {
+	db      *gorm.DB
+	topic   string
+	workers int
+}
+
+func NewConsumer(db *gorm.DB, topic string, workers int) *Consumer {
+	return &Consumer{db: db, topic: topic, workers: workers}
+}
+
+func (c *Consumer) Consume(ctx context.Context, handler queue.Handler) error {
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c.work(ctx, handler)
+		}()
+	}
+
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+func (c *Consumer) work(ctx context.Context, handler queue.Handler) {
+	for {
+		found, err := c.consumeOne(ctx, handler)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error(fmt.Sprintf("queue %s: %v", c.topic, err))
+		}
+
+		if found && err == nil {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+
+		// Wait for new messages
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// consumeOne processes the first available message, if any.
+// On failure the message is made available again after an exponential backoff.
+func (c *Consumer) consumeOne(ctx context.Context, handler queue.Handler) (bool, error) {
+	message, err := c.lease(ctx)
+	if err != nil || message == nil {
+		return false, err
+	}
+
+	// The handler runs outside of the transaction, so that the row is not locked
+	// and the connection is not held while the message is processed
+	handlerErr := handler(ctx, message.Data)
+	if handlerErr == nil {
+		return true, c.db.WithContext(ctx).Delete(message).Error
+	}
+
+	slog.Error(fmt.Sprintf("queue %s: message %d failed, attempt %d of %d: %v", c.topic, message.ID, message.Attempts, maxAttempts, handlerErr))
+
+	updates := map[string]any{
+		"available_at": time.Now().Add(backoff(message.Attempts)),
+		"error":        handlerErr.Error(),
+	}
+	if queue.IsPermanent(handlerErr) || message.Attempts >= maxAttempts {
+		slog.Error(fmt.Sprintf("queue %s: message %d moved to the dead letters", c.topic, message.ID))
+		updates["dead_at"] = time.Now()
+	}
+
+	return true, c.db.WithContext(ctx).Model(message).Updates(updates).Error
+}
+
+// lease reserves the first available message for leaseDuration and counts the delivery attempt.
+// It returns nil if there are no available messages.
+func (c *Consumer) lease(ctx context.Context) (*events_models.QueueMessage, error) {
+	var message *events_models.QueueMessage
+
+	err := c.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var candidate events_models.QueueMessage
+		result := tx.
+			Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("topic = ?", c.topic).
+			Where("dead_at IS NULL").
+			Where("available_at <= ?", time.Now()).
+			Order("id").
+			Limit(1).
+			Find(&candidate)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		attempts := candidate.Attempts + 1
+		err := tx.Model(&candidate).Updates(map[string]any{
+			"attempts":     attempts,
+			"available_at": time.Now().Add(leaseDuration),
+		}).Error
+		if err != nil {
+			return err
+		}
+
+		candidate.Attempts = attempts
+		message = &candidate
+		return nil
+	})
+
+	return message, err
+}
+
+func backoff(attempts int) time.Duration {
+	if attempts > 10 {
+		return maxBackoff
+	}
+
+	delay := time.Duration(1<<attempts) * time.Second
+	if delay > maxBackoff {
+		return maxBackoff
+	}
+
+	return delay
+}
@@ -0,0 +1,134 @@
+package pubsub
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"cloud.google.com/go/pubsub"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+)
+
+// Publisher sends messages to a Google Cloud Pub/Sub topic.
+type Publisher struct {
+	client *pubsub.Client
+	topic  *pubsub.Topic
+}
+
+func NewPublisher(ctx context.Context, projectId string, topicId string) (*Publisher, error) {
+	client, err := pubsub.NewClient(ctx, projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Publisher{client: client, topic: client.Topic(topicId)}, nil
+}
+
+func (p *Publisher) Publish(ctx context.Context, data ...[]byte) error {
+	var wg sync.WaitGroup
+	var totalErrors uint64
+
+	for _, messageData := range data {
+		result := p.topic.Publish(ctx, &pubsub.Message{
+			Data: messageData,
+		})
+
+		wg.Add(1)
+		go func(res *pubsub.PublishResult) {
+			defer wg.Done()
+			_, err := res.Get(ctx)
+			if err != nil {
+				atomic.AddUint64(&totalErrors, 1)
+				return
+			}
+		}(result)
+	}
+
+	wg.Wait()
+
+	if totalErrors > 0 {
+		return fmt.Errorf("%d of %d messages did not publish successfully", totalErrors, len(data))
+	}
+
+	return nil
+}
+
+func (p *Publisher) Close() error {
+	p.topic.Stop()
+	return p.client.Close()
+}
+
+// Consumer pulls the messages of a Google Cloud Pub/Sub subscription.
+type Consumer struct {
+	client       *pubsub.Client
+	subscription *pubsub.Subscription
+}
+
+func NewConsumer(ctx context.Context, projectId string, subscriptionId string) (*Consumer, error) {
+	client, err := pubsub.NewClient(ctx, projectId)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Consumer{client: client, subscription: client.Subscription(subscriptionId)}, nil
+}
+
+func (c *Consumer) Consume(ctx context.Context, handler queue.Handler) error {
+	return c.subscription.Receive(ctx, func(ctx context.Context, msg *pubsub.Message) {
+		if err := handler(ctx, msg.Data); err != nil {
+			slog.Error(fmt.Sprintf("message %s: %v", msg.ID, err))
+			msg.Nack()
+			return
+		}
+
+		msg.Ack()
+	})
+}
+
+func (c *Consumer) Close() error {
+	return c.client.Close()
+}
+
+type pushMessage struct {
+	Message struct {
+		Data []byte `json:"data,omitempty"`
+		ID   string `json:"id"`
+	} `json:"message"`
+	Subscription string `json:"subscription"`
+}
+
+// PushHandler receives the messages of a push subscription.
+// The message is acknowledged only if the handler succeeds.
+func PushHandler(handler queue.Handler) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		defer r.Body.Close()
+		if err != nil {
+			slog.Error(fmt.Sprintf("io.ReadAll: %v", err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		// A request which is not a push message is rejected, so that it is not lost
+		// and ends in the dead letter topic of the subscription, if any
+		var m pushMessage
+		if err := json.Unmarshal(body, &m); err != nil {
+			slog.Error(fmt.Sprintf("json.Unmarshal: invalid push message: %v", err))
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if err := handler(r.Context(), m.Message.Data); err != nil {
+			slog.Error(fmt.Sprintf("message %s: %v", m.Message.ID, err))
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}
+}
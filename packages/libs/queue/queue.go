@@ -0,0 +1,59 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+)
+
+// Handler processes the data of a received message.
+// If it returns an error, the message is delivered again later.
+type Handler func(ctx context.Context, data []byte) error
+
+// IsPermanent reports whether the error returned by a handler is marked as permanent
+// (e.g. by jobs.Permanent), so that delivering the message again cannot succeed.
+func IsPermanent(err error) bool {
+	var permanentErr interface{ Permanent() bool }
+	return errors.As(err, &permanentErr) && permanentErr.Permanent()
+}
+
+// Publisher sends messages to a topic.
+type Publisher interface {
+	Publish(ctx context.Context, data ...[]byte) error
+	Close() error
+}
+
+// Consumer receives the messages of a topic.
+type Consumer interface {
+	// Consume calls the handler for each message until the context is canceled.
+	Consume(ctx context.Context, handler Handler) error
+}
+
+// PublishJSON sends the messages encoded as JSON.
+func PublishJSON[T any](ctx context.Context, publisher Publisher, messages ...T) error {
+	if len(messages) == 0 {
+		return nil
+	}
+
+	data := make([][]byte, len(messages))
+	for i, message := range messages {
+		encoded, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+
+		data[i] = encoded
+	}
+
+	return publisher.Publish(ctx, data...)
+}
+
+// DecodeJSON decodes the data of a message sent with PublishJSON.
+func DecodeJSON[T any](data []byte) (*T, error) {
+	message := new(T)
+	if err := json.Unmarshal(data, message); err != nil {
+		return nil, err
+	}
+
+	return message, nil
+}
@@ -0,0 +1,93 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+
+	"gorm.io/gorm"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue/postgres"
+	"riccardotornesello.it/sharedtelemetry/iracing/queue/pubsub"
+)
+
+const (
+	DriverPubSub   = "pubsub"
+	DriverPostgres = "postgres"
+)
+
+// SeasonsTopic returns the topic of the seasons to parse: SEASONS_TOPIC if set,
+// otherwise queue.SeasonsTopic.
+// With Pub/Sub it is the topic ID, with Postgres the topic name.
+func SeasonsTopic() string {
+	return topicFromEnv("SEASONS_TOPIC", queue.SeasonsTopic)
+}
+
+// SessionsTopic returns the topic of the sessions to download: SESSIONS_TOPIC if set,
+// otherwise queue.SessionsTopic.
+func SessionsTopic() string {
+	return topicFromEnv("SESSIONS_TOPIC", queue.SessionsTopic)
+}
+
+func topicFromEnv(name string, defaultTopic string) string {
+	if topic := os.Getenv(name); topic != "" {
+		return topic
+	}
+
+	return defaultTopic
+}
+
+// Config selects the queue implementation used by a service.
+type Config struct {
+	Driver          string // DriverPubSub (default) or DriverPostgres
+	PubSubProjectId string
+	Db              *gorm.DB // Used by the Postgres driver
+	Workers         int      // Concurrent consumers, used by the Postgres driver
+}
+
+func (c *Config) driver() string {
+	if c.Driver == "" {
+		return DriverPubSub
+	}
+
+	return c.Driver
+}
+
+// NewPublisher returns a publisher for the topic: the topic ID for Pub/Sub,
+// the topic name for Postgres.
+func (c *Config) NewPublisher(ctx context.Context, topic string) (queue.Publisher, error) {
+	switch c.driver() {
+	case DriverPubSub:
+		return pubsub.NewPublisher(ctx, c.PubSubProjectId, topic)
+	case DriverPostgres:
+		return postgres.NewPublisher(c.Db, topic), nil
+	default:
+		return nil, fmt.Errorf("invalid queue driver: %s", c.Driver)
+	}
+}
+
+// Consume starts delivering the messages of the topic to the handler.
+// With Pub/Sub the messages are pushed by the subscription to the root of the mux,
+// with Postgres they are pulled in background until the context is canceled.
+func (c *Config) Consume(ctx context.Context, mux *http.ServeMux, topic string, handler queue.Handler) error {
+	switch c.driver() {
+	case DriverPubSub:
+		mux.HandleFunc("/", pubsub.PushHandler(handler))
+	case DriverPostgres:
+		workers := c.Workers
+		if workers < 1 {
+			workers = 1
+		}
+
+		go func() {
+			err := postgres.NewConsumer(c.Db, topic, workers).Consume(ctx, handler)
+			slog.Info(fmt.Sprintf("queue %s: consumer stopped: %v", topic, err))
+		}()
+	default:
+		return fmt.Errorf("invalid queue driver: %s", c.Driver)
+	}
+
+	return nil
+}